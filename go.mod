@@ -0,0 +1,7 @@
+module github.com/rmanzoku/mackerel-plugin-puma
+
+go 1.17
+
+require github.com/mackerelio/go-mackerel-plugin v0.1.4
+
+require github.com/mackerelio/golib v1.2.1 // indirect
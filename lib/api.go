@@ -0,0 +1,37 @@
+package mppuma
+
+import (
+	"os"
+
+	"github.com/rmanzoku/mackerel-plugin-puma/lib/client"
+)
+
+// Environment variable used when neither -token nor -token-file is given
+const tokenEnv = "PUMA_CONTROL_TOKEN"
+
+// Settings of the control server client
+func (p PumaPlugin) clientConfig() client.Config {
+	config := client.Config{
+		Host:               p.Host,
+		Port:               p.Port,
+		Sock:               p.Sock,
+		Token:              p.Token,
+		TokenFile:          p.TokenFile,
+		TokenHeader:        p.TokenHeader,
+		TLS:                p.TLS,
+		CAFile:             p.CAFile,
+		CertFile:           p.CertFile,
+		KeyFile:            p.KeyFile,
+		InsecureSkipVerify: p.InsecureSkipVerify,
+		Timeout:            p.Timeout,
+	}
+	if config.Token == "" && config.TokenFile == "" {
+		config.Token = os.Getenv(tokenEnv)
+	}
+	return config
+}
+
+// Client for the control server
+func (p PumaPlugin) newClient() (*client.Client, error) {
+	return client.New(p.clientConfig())
+}
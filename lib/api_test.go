@@ -0,0 +1,23 @@
+package mppuma
+
+import "testing"
+
+func TestClientConfigTokenEnv(t *testing.T) {
+	t.Setenv(tokenEnv, "from-env")
+
+	var p PumaPlugin
+	if token := p.clientConfig().Token; token != "from-env" {
+		t.Errorf("token should be from-env, out %q", token)
+	}
+
+	p.Token = "from-flag"
+	if token := p.clientConfig().Token; token != "from-flag" {
+		t.Errorf("token should be from-flag, out %q", token)
+	}
+
+	p.Token = ""
+	p.TokenFile = "/path/to/token"
+	if token := p.clientConfig().Token; token != "" {
+		t.Errorf("token should be read from the file, out %q", token)
+	}
+}
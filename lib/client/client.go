@@ -0,0 +1,227 @@
+// Package client is a client for the Puma control app.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config to reach a control server
+type Config struct {
+	Host string
+	Port string
+	// Connect to this unix socket instead of Host and Port
+	Sock string
+
+	Token string
+	// Read the token from this file on every request instead of Token
+	TokenFile string
+	// Send the token in this header instead of the query string
+	TokenHeader string
+
+	// Connect with https, verifying against CAFile and sending CertFile/KeyFile
+	TLS                bool
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+
+	// Timeout of each request, 0 for none
+	Timeout time.Duration
+}
+
+// Client for the control server
+type Client struct {
+	config     Config
+	httpClient *http.Client
+}
+
+// New client for the control server, over unix socket and TLS if configured
+func New(config Config) (*Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if config.Sock != "" {
+		transport.DialContext = func(ctx context.Context, proto, addr string) (conn net.Conn, err error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", config.Sock)
+		}
+	}
+
+	if config.TLS {
+		tlsConfig, err := config.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &Client{
+		config:     config,
+		httpClient: &http.Client{Transport: transport, Timeout: config.Timeout},
+	}, nil
+}
+
+// Token for the control server, re-reading TokenFile on every call so rotations apply
+func (c Config) token() (string, error) {
+	if c.TokenFile == "" {
+		return c.Token, nil
+	}
+
+	b, err := os.ReadFile(c.TokenFile)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(b))
+
+	if c.Token != "" && c.Token != token {
+		return "", errors.New("token and token file have different values")
+	}
+	return token, nil
+}
+
+// URL of a control endpoint, with token in the query string unless sent via header
+func (c Config) url(path, token string) string {
+	scheme := "http"
+	if c.TLS {
+		scheme = "https"
+	}
+
+	// Host and port are not used to connect to a unix socket
+	host := "localhost"
+	if c.Sock == "" {
+		host = net.JoinHostPort(c.Host, c.Port)
+	}
+
+	u := url.URL{
+		Scheme: scheme,
+		Host:   host,
+		Path:   "/" + path,
+	}
+	if c.TokenHeader == "" {
+		u.RawQuery = url.Values{"token": {token}}.Encode()
+	}
+	return u.String()
+}
+
+// GET request to a control endpoint
+func (c *Client) get(ctx context.Context, path string) (*http.Response, error) {
+	token, err := c.config.token()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.config.url(path, token), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.config.TokenHeader != "" {
+		value := token
+		if strings.EqualFold(c.config.TokenHeader, "Authorization") {
+			value = "Bearer " + token
+		}
+		req.Header.Set(c.config.TokenHeader, value)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// Do not leak the token into logs
+		if ue, ok := err.(*url.Error); ok {
+			ue.URL = c.config.url(path, "REDACTED")
+		}
+		return nil, &ConnectionError{Err: err}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &StatusError{Path: path, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	return resp, nil
+}
+
+// GET request to a control endpoint, decoding the JSON response into v
+func (c *Client) getJSON(ctx context.Context, path string, v interface{}) error {
+	resp, err := c.get(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return &DecodeError{Path: path, Err: err}
+	}
+	return nil
+}
+
+// Stats fetches /stats
+func (c *Client) Stats(ctx context.Context) (*Stats, error) {
+	var stats Stats
+	if err := c.getJSON(ctx, "stats", &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// GCStats fetches /gc-stats, available since Puma 3.10.0
+func (c *Client) GCStats(ctx context.Context) (*GCStats, error) {
+	var gcStats GCStats
+	if err := c.getJSON(ctx, "gc-stats", &gcStats); err != nil {
+		return nil, err
+	}
+	return &gcStats, nil
+}
+
+// ThreadBacktraces fetches /thread-backtraces, available since Puma 4.0.0
+func (c *Client) ThreadBacktraces(ctx context.Context) ([]ThreadBacktrace, error) {
+	var backtraces []ThreadBacktrace
+	if err := c.getJSON(ctx, "thread-backtraces", &backtraces); err != nil {
+		return nil, err
+	}
+	return backtraces, nil
+}
+
+// Command sends a control command such as "phased-restart"
+func (c *Client) Command(ctx context.Context, command string) error {
+	resp, err := c.get(ctx, command)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Restart the server, re-executing the master
+func (c *Client) Restart(ctx context.Context) error {
+	return c.Command(ctx, "restart")
+}
+
+// PhasedRestart restarts workers one by one (cluster mode only)
+func (c *Client) PhasedRestart(ctx context.Context) error {
+	return c.Command(ctx, "phased-restart")
+}
+
+// ReloadWorkerDirectory reloads the directory workers are started in
+func (c *Client) ReloadWorkerDirectory(ctx context.Context) error {
+	return c.Command(ctx, "reload-worker-directory")
+}
+
+// GC runs GC.start in the server
+func (c *Client) GC(ctx context.Context) error {
+	return c.Command(ctx, "gc")
+}
+
+// Halt the server immediately
+func (c *Client) Halt(ctx context.Context) error {
+	return c.Command(ctx, "halt")
+}
+
+// Stop the server gracefully
+func (c *Client) Stop(ctx context.Context) error {
+	return c.Command(ctx, "stop")
+}
@@ -0,0 +1,153 @@
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rmanzoku/mackerel-plugin-puma/lib/pumatest"
+)
+
+// Config pointed at a test server
+func testConfig(t *testing.T, rawurl string) Config {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var c Config
+	c.Host, c.Port, err = net.SplitHostPort(u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// GET request with a new Client
+func testGet(c Config, path string) error {
+	client, err := New(c)
+	if err != nil {
+		return err
+	}
+	resp, err := client.get(context.Background(), path)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func TestGetEscapesToken(t *testing.T) {
+	var token string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = r.URL.Query().Get("token")
+	}))
+	defer ts.Close()
+
+	config := testConfig(t, ts.URL)
+	config.Token = "a&b#c d"
+
+	if err := testGet(config, "stats"); err != nil {
+		t.Fatal(err)
+	}
+
+	if token != config.Token {
+		t.Errorf("token should be %q, out %q", config.Token, token)
+	}
+}
+
+func TestGetTokenHeader(t *testing.T) {
+	cases := []struct {
+		header  string
+		desired string
+	}{
+		{"Authorization", "Bearer 12345"},
+		{"X-Puma-Token", "12345"},
+	}
+
+	for _, c := range cases {
+		var header, query string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header = r.Header.Get(c.header)
+			query = r.URL.RawQuery
+		}))
+
+		config := testConfig(t, ts.URL)
+		config.Token = "12345"
+		config.TokenHeader = c.header
+
+		err := testGet(config, "stats")
+		ts.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if header != c.desired {
+			t.Errorf("%s should be %q, out %q", c.header, c.desired, header)
+		}
+		if query != "" {
+			t.Errorf("query should be empty, out %q", query)
+		}
+	}
+}
+
+func TestGetRedactsToken(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	config := testConfig(t, ts.URL)
+	config.Token = "s3cr&t"
+	ts.Close()
+
+	err := testGet(config, "stats")
+	if err == nil {
+		t.Fatal("get should fail against a closed server")
+	}
+	if strings.Contains(err.Error(), "s3cr") {
+		t.Errorf("error should not contain the token: %s", err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	s := pumatest.NewServer(pumatest.Puma6Cluster)
+	defer s.Close()
+	s.SetToken("12345")
+
+	c, err := New(Config{Host: s.Host, Port: s.Port, Token: "12345"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	stats, err := c.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Workers != 2 || len(stats.WorkerStatus) != 2 {
+		t.Errorf("Stats: workers should be 2, out %d", stats.Workers)
+	}
+
+	gcStats, err := c.GCStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gcStats.Count.String() != "21" {
+		t.Errorf("GCStats: count should be 21, out %s", gcStats.Count)
+	}
+
+	backtraces, err := c.ThreadBacktraces(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backtraces) != 1 || len(backtraces[0].Backtrace) == 0 {
+		t.Errorf("ThreadBacktraces: should have a backtrace, out %+v", backtraces)
+	}
+
+	if err := c.PhasedRestart(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Requests("/phased-restart"); n != 1 {
+		t.Errorf("/phased-restart should be requested once, out %d", n)
+	}
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+var (
+	// ErrUnauthorized is matched by a StatusError for a rejected token
+	ErrUnauthorized = errors.New("token rejected")
+	// ErrNotFound is matched by a StatusError for an endpoint this Puma does not have
+	ErrNotFound = errors.New("endpoint not found")
+	// ErrConnectionRefused is matched by a ConnectionError when nothing listens on the address
+	ErrConnectionRefused = errors.New("connection refused")
+	// ErrTimeout is matched by a ConnectionError when the request timed out
+	ErrTimeout = errors.New("timeout")
+)
+
+// StatusError is a non-200 response from the control server
+type StatusError struct {
+	Path       string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("/%s: %s", e.Path, e.Status)
+}
+
+// Unwrap to ErrUnauthorized or ErrNotFound
+func (e *StatusError) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrUnauthorized
+	case http.StatusNotFound:
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DecodeError is a response that is not the JSON expected
+type DecodeError struct {
+	Path string
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("/%s: malformed response: %s", e.Path, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// ConnectionError is a failure to reach the control server
+type ConnectionError struct {
+	Err error
+}
+
+func (e *ConnectionError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConnectionError) Unwrap() error {
+	return e.Err
+}
+
+// Is ErrConnectionRefused for a closed port or a missing unix socket, ErrTimeout for a timeout
+func (e *ConnectionError) Is(target error) bool {
+	switch target {
+	case ErrConnectionRefused:
+		return errors.Is(e.Err, syscall.ECONNREFUSED) || errors.Is(e.Err, syscall.ENOENT)
+	case ErrTimeout:
+		var ne net.Error
+		return errors.Is(e.Err, context.DeadlineExceeded) || (errors.As(e.Err, &ne) && ne.Timeout())
+	}
+	return false
+}
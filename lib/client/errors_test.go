@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rmanzoku/mackerel-plugin-puma/lib/pumatest"
+)
+
+func TestClientErrors(t *testing.T) {
+	s := pumatest.NewServer(pumatest.Puma3Cluster)
+	defer s.Close()
+	s.SetToken("12345")
+
+	ctx := context.Background()
+
+	c, _ := New(Config{Host: s.Host, Port: s.Port, Token: "54321"})
+	if _, err := c.Stats(ctx); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Stats with a wrong token should be ErrUnauthorized, out %v", err)
+	}
+
+	c, _ = New(Config{Host: s.Host, Port: s.Port, Token: "12345"})
+	if _, err := c.ThreadBacktraces(ctx); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ThreadBacktraces on Puma 3 should be ErrNotFound, out %v", err)
+	}
+
+	s.SetVersion(pumatest.Version{Stats: `{"workers": `})
+	var decodeErr *DecodeError
+	if _, err := c.Stats(ctx); !errors.As(err, &decodeErr) {
+		t.Errorf("Stats with malformed JSON should be a DecodeError, out %v", err)
+	}
+
+	s.SetStatus("/stats", http.StatusInternalServerError)
+	var statusErr *StatusError
+	if _, err := c.Stats(ctx); !errors.As(err, &statusErr) || statusErr.StatusCode != 500 {
+		t.Errorf("Stats should be a StatusError with 500, out %v", err)
+	}
+
+	c, _ = New(Config{Sock: "/nonexistent/pumactl.sock"})
+	if _, err := c.Stats(ctx); !errors.Is(err, ErrConnectionRefused) {
+		t.Errorf("Stats on a missing socket should be ErrConnectionRefused, out %v", err)
+	}
+
+	s.SetStatus("/stats", 0)
+	s.SetLatency(100 * time.Millisecond)
+	c, _ = New(Config{Host: s.Host, Port: s.Port, Token: "12345", Timeout: 10 * time.Millisecond})
+	if _, err := c.Stats(ctx); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Stats on a slow server should be ErrTimeout, out %v", err)
+	}
+
+	s.Close()
+	c, _ = New(Config{Host: s.Host, Port: s.Port})
+	if _, err := c.Stats(ctx); !errors.Is(err, ErrConnectionRefused) {
+		t.Errorf("Stats on a closed port should be ErrConnectionRefused, out %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Write the test server certificate and key as PEM files
+func writeTestCert(t *testing.T, ts *httptest.Server) (certFile, keyFile string) {
+	dir := t.TempDir()
+
+	certFile = filepath.Join(dir, "cert.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := os.WriteFile(certFile, cert, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(ts.TLS.Certificates[0].PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile = filepath.Join(dir, "key.pem")
+	key := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(keyFile, key, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestGetTLS(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Config.ErrorLog = log.New(io.Discard, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+
+	certFile, _ := writeTestCert(t, ts)
+
+	c := testConfig(t, ts.URL)
+	c.TLS = true
+
+	if err := testGet(c, "stats"); err == nil {
+		t.Error("get should fail without the CA")
+	}
+
+	c.CAFile = certFile
+	if err := testGet(c, "stats"); err != nil {
+		t.Fatal(err)
+	}
+
+	c.CAFile = ""
+	c.InsecureSkipVerify = true
+	if err := testGet(c, "stats"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetTLSClientCertificate(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	ts.Config.ErrorLog = log.New(io.Discard, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+
+	certFile, keyFile := writeTestCert(t, ts)
+
+	c := testConfig(t, ts.URL)
+	c.TLS = true
+	c.CAFile = certFile
+
+	if err := testGet(c, "stats"); err == nil {
+		t.Error("get should fail without a client certificate")
+	}
+
+	c.CertFile = certFile
+	c.KeyFile = keyFile
+	if err := testGet(c, "stats"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestToken(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		token     string
+		tokenFile string
+		desired   string
+		fail      bool
+	}{
+		{"", "", "", false},
+		{"from-flag", "", "from-flag", false},
+		{"", tokenFile, "from-file", false},
+		{"from-file", tokenFile, "from-file", false},
+		{"from-flag", tokenFile, "", true},
+		{"", tokenFile + ".missing", "", true},
+	}
+
+	for _, tc := range cases {
+		var c Config
+		c.Token = tc.token
+		c.TokenFile = tc.tokenFile
+
+		ret, err := c.token()
+		if tc.fail {
+			if err == nil {
+				t.Errorf("token(%q, %q) should fail", tc.token, tc.tokenFile)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("token(%q, %q): %s", tc.token, tc.tokenFile, err)
+		}
+		if ret != tc.desired {
+			t.Errorf("token(%q, %q) should be %q, out %q", tc.token, tc.tokenFile, tc.desired, ret)
+		}
+	}
+}
+
+func TestTokenFileRotation(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+
+	var c Config
+	c.TokenFile = tokenFile
+
+	for _, desired := range []string{"first", "second"} {
+		if err := os.WriteFile(tokenFile, []byte(desired), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if ret, _ := c.token(); ret != desired {
+			t.Errorf("token should be %q, out %q", desired, ret)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Stats is convered from /stats json
+type Stats struct {
+	Workers       int            `json:"workers"`
+	Phase         int            `json:"phase"`
+	BootedWorkers int            `json:"booted_workers"`
+	OldWorkers    int            `json:"old_workers"`
+	WorkerStatus  []WorkerStatus `json:"worker_status"`
+	// Single mode
+	Backlog      int `json:"backlog"`
+	Running      int `json:"running"`
+	PoolCapacity int `json:"pool_capacity"`
+	// Added since Puma 4.0
+	MaxThreads int `json:"max_threads"`
+	// Added since Puma 5.0
+	RequestsCount *int      `json:"requests_count"`
+	StartedAt     time.Time `json:"started_at"`
+	// Added since Puma 6.0
+	Versions *Versions `json:"versions"`
+}
+
+// Versions of Puma and Ruby running the server
+type Versions struct {
+	Puma string      `json:"puma"`
+	Ruby RubyVersion `json:"ruby"`
+}
+
+// RubyVersion is the Ruby engine running the server
+type RubyVersion struct {
+	Engine     string `json:"engine"`
+	Version    string `json:"version"`
+	Patchlevel int    `json:"patchlevel"`
+}
+
+// WorkerStatus is a worker in cluster mode
+type WorkerStatus struct {
+	Pid         int        `json:"pid"`
+	Index       int        `json:"index"`
+	Phase       int        `json:"phase"`
+	Booted      bool       `json:"booted"`
+	LastCheckin time.Time  `json:"last_checkin"`
+	LastStatus  LastStatus `json:"last_status"`
+	// Added since Puma 5.0
+	StartedAt time.Time `json:"started_at"`
+}
+
+// LastStatus is the thread pool of a worker at its last checkin
+type LastStatus struct {
+	// False until the worker has checked in, when Puma sends an empty last_status
+	Reported bool `json:"-"`
+
+	Backlog      int `json:"backlog"`
+	Running      int `json:"running"`
+	PoolCapacity int `json:"pool_capacity"`
+	// Added since Puma 4.0
+	MaxThreads int `json:"max_threads"`
+	// Added since Puma 5.0
+	RequestsCount *int `json:"requests_count"`
+}
+
+// UnmarshalJSON sets Reported for a non-empty last_status
+func (s *LastStatus) UnmarshalJSON(b []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+
+	// Without the method, to not recurse
+	type lastStatus LastStatus
+	var v lastStatus
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*s = LastStatus(v)
+	s.Reported = len(fields) > 0
+	return nil
+}
+
+// GCStats is convered from /gc-stats json
+type GCStats struct {
+	// Ruby2.0
+	Count                json.Number `json:"count"`
+	HeapFinalNum         json.Number `json:"heap_final_num"`
+	HeapFreeNum          json.Number `json:"heap_free_num"`
+	HeapIncrement        json.Number `json:"heap_increment"`
+	HeapLength           json.Number `json:"heap_length"`
+	HeapLiveNum          json.Number `json:"heap_live_num"`
+	HeapUsed             json.Number `json:"heap_used"`
+	TotalAllocatedObject json.Number `json:"total_allocated_object"`
+	TotalFreedObject     json.Number `json:"total_freed_object"`
+	// Added since Ruby2.1
+	HeapLiveSlot               json.Number `json:"heap_live_slot"`
+	HeapFreeSlot               json.Number `json:"heap_free_slot"`
+	HeapFinalSlot              json.Number `json:"heap_final_slot"`
+	HeapSweptSlot              json.Number `json:"heap_swept_slot"`
+	HeapEdenPageLength         json.Number `json:"heap_eden_page_length"`
+	HeapTombPageLength         json.Number `json:"heap_tomb_page_length"`
+	MallocIncrease             json.Number `json:"malloc_increase"`
+	MallocLimit                json.Number `json:"malloc_limit"`
+	MinorGcCount               json.Number `json:"minor_gc_count"`
+	MajorGcCount               json.Number `json:"major_gc_count"`
+	RememberedShadyObject      json.Number `json:"remembered_shady_object"`
+	RememberedShadyObjectLimit json.Number `json:"remembered_shady_object_limit"`
+	OldObject                  json.Number `json:"old_object"`
+	OldObjectLimit             json.Number `json:"old_object_limit"`
+	OldmallocIncrease          json.Number `json:"oldmalloc_increase"`
+	OldmallocLimit             json.Number `json:"oldmalloc_limit"`
+	// Added since Ruby2.2
+	HeapAllocatedPages                  json.Number `json:"heap_allocated_pages"`
+	HeapSortedLength                    json.Number `json:"heap_sorted_length"`
+	HeapAllocatablePages                json.Number `json:"heap_allocatable_pages"`
+	HeapAvailableSlots                  json.Number `json:"heap_available_slots"`
+	HeapLiveSlots                       json.Number `json:"heap_live_slots"`
+	HeapFreeSlots                       json.Number `json:"heap_free_slots"`
+	HeapFinalSlots                      json.Number `json:"heap_final_slots"`
+	HeapMarkedSlots                     json.Number `json:"heap_marked_slots"`
+	HeapSweptSlots                      json.Number `json:"heap_swept_slots"`
+	HeapEdenPages                       json.Number `json:"heap_eden_pages"`
+	HeapTombPages                       json.Number `json:"heap_tomb_pages"`
+	TotalAllocatedPages                 json.Number `json:"total_allocated_pages"`
+	TotalFreedPages                     json.Number `json:"total_freed_pages"`
+	TotalAllocatedObjects               json.Number `json:"total_allocated_objects"`
+	TotalFreedObjects                   json.Number `json:"total_freed_objects"`
+	MallocIncreaseBytes                 json.Number `json:"malloc_increase_bytes"`
+	MallocIncreaseBytesLimit            json.Number `json:"malloc_increase_bytes_limit"`
+	RememberedWbUnprotectedObjects      json.Number `json:"remembered_wb_unprotected_objects"`
+	RememberedWbUnprotectedObjectsLimit json.Number `json:"remembered_wb_unprotected_objects_limit"`
+	OldObjects                          json.Number `json:"old_objects"`
+	OldObjectsLimit                     json.Number `json:"old_objects_limit"`
+	OldmallocIncreaseBytes              json.Number `json:"oldmalloc_increase_bytes"`
+	OldmallocIncreaseBytesLimit         json.Number `json:"oldmalloc_increase_bytes_limit"`
+	// Ruby2.3 is same as Ruby2.2
+	// Ruby2.4 is almost same Ruby2.3 (deletes heap_swept_slots)
+}
+
+// ThreadBacktrace is a thread in /thread-backtraces json
+type ThreadBacktrace struct {
+	Name      string   `json:"name"`
+	Backtrace []string `json:"backtrace"`
+}
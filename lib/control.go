@@ -0,0 +1,129 @@
+package mppuma
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+)
+
+// Control server endpoints available as subcommands
+var controlCommands = []string{
+	"restart",
+	"phased-restart",
+	"reload-worker-directory",
+	"gc",
+	"halt",
+	"stop",
+}
+
+func isControlCommand(command string) bool {
+	for _, c := range controlCommands {
+		if c == command {
+			return true
+		}
+	}
+	return false
+}
+
+// GET request to a control endpoint such as /restart
+func (p PumaPlugin) sendControlCommand(command string) error {
+	c, err := p.newClient()
+	if err != nil {
+		return err
+	}
+	return c.Command(context.Background(), command)
+}
+
+// restarted reports whether every worker in cur was booted after prev was taken,
+// with down telling whether a poll in between found the control server unavailable
+func restarted(command string, prev, cur *Stats, down bool) bool {
+	if command == "phased-restart" && cur.Phase <= prev.Phase {
+		return false
+	}
+
+	// Without workers the old process answers the same, so only a new started_at (Puma 5.0+)
+	// or a poll missing the re-executing server tells it has restarted
+	if prev.Workers == 0 {
+		return down || !cur.StartedAt.IsZero() && !cur.StartedAt.Equal(prev.StartedAt)
+	}
+
+	if cur.BootedWorkers != cur.Workers || len(cur.WorkerStatus) != cur.Workers {
+		return false
+	}
+
+	old := make(map[int]bool)
+	for _, v := range prev.WorkerStatus {
+		old[v.Pid] = true
+	}
+	for _, v := range cur.WorkerStatus {
+		if !v.Booted || v.Phase != cur.Phase || old[v.Pid] {
+			return false
+		}
+	}
+	return true
+}
+
+// Poll /stats until the restart triggered after prev has finished
+func (p PumaPlugin) waitRestart(command string, prev *Stats, timeout, interval time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	down := false
+
+	for {
+		time.Sleep(interval)
+
+		// The control server is unavailable while the master re-executes itself
+		cur, err := p.getStatsAPI()
+		if err != nil {
+			down = true
+		} else if restarted(command, prev, cur, down) {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			if err != nil {
+				return fmt.Errorf("%s did not finish within %s: %s", command, timeout, err)
+			}
+			if prev.Workers == 0 {
+				return fmt.Errorf("%s did not finish within %s: started_at unchanged and /stats never unavailable", command, timeout)
+			}
+			return fmt.Errorf("%s did not finish within %s: %d/%d workers booted on phase %d",
+				command, timeout, cur.BootedWorkers, cur.Workers, cur.Phase)
+		}
+	}
+}
+
+// Run a control subcommand with its own flags
+func doControl(command string, args []string) error {
+	var p PumaPlugin
+
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	p.connectionFlags(fs)
+	optWait := fs.Bool("wait", false, "Wait until all workers are booted after restart or phased-restart")
+	optWaitTimeout := fs.Duration("wait-timeout", 60*time.Second, "Maximum time to wait with -wait")
+	fs.Parse(args)
+
+	wait := *optWait && (command == "restart" || command == "phased-restart")
+
+	var prev *Stats
+	if wait {
+		var err error
+		if prev, err = p.getStatsAPI(); err != nil {
+			return err
+		}
+		if command == "phased-restart" && prev.Workers == 0 {
+			return errors.New("phased-restart is not available in single mode")
+		}
+	}
+
+	if err := p.sendControlCommand(command); err != nil {
+		return err
+	}
+	fmt.Printf("Command %s sent success\n", command)
+
+	if !wait {
+		return nil
+	}
+	return p.waitRestart(command, prev, *optWaitTimeout, time.Second)
+}
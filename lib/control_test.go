@@ -0,0 +1,114 @@
+package mppuma
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/rmanzoku/mackerel-plugin-puma/lib/pumatest"
+)
+
+func TestRestarted(t *testing.T) {
+
+	prevJSON := `{
+	  "workers": 2,
+	  "phase": 0,
+	  "booted_workers": 2,
+	  "old_workers": 0,
+	  "worker_status": [
+	    {"pid": 1, "index": 0, "phase": 0, "booted": true},
+	    {"pid": 2, "index": 1, "phase": 0, "booted": true}
+	  ]
+	}`
+
+	cases := []struct {
+		command string
+		json    string
+		desired bool
+	}{
+		{"phased-restart", prevJSON, false},
+		{"phased-restart", `{
+		  "workers": 2, "phase": 1, "booted_workers": 1, "old_workers": 1,
+		  "worker_status": [
+		    {"pid": 3, "index": 0, "phase": 1, "booted": true},
+		    {"pid": 2, "index": 1, "phase": 0, "booted": true}
+		  ]
+		}`, false},
+		{"phased-restart", `{
+		  "workers": 2, "phase": 1, "booted_workers": 2, "old_workers": 0,
+		  "worker_status": [
+		    {"pid": 3, "index": 0, "phase": 1, "booted": true},
+		    {"pid": 4, "index": 1, "phase": 1, "booted": true}
+		  ]
+		}`, true},
+		{"restart", `{
+		  "workers": 2, "phase": 0, "booted_workers": 1, "old_workers": 0,
+		  "worker_status": [
+		    {"pid": 3, "index": 0, "phase": 0, "booted": true},
+		    {"pid": 4, "index": 1, "phase": 0, "booted": false}
+		  ]
+		}`, false},
+		{"restart", `{
+		  "workers": 2, "phase": 0, "booted_workers": 2, "old_workers": 0,
+		  "worker_status": [
+		    {"pid": 3, "index": 0, "phase": 0, "booted": true},
+		    {"pid": 4, "index": 1, "phase": 0, "booted": true}
+		  ]
+		}`, true},
+	}
+
+	var prev Stats
+	json.Unmarshal([]byte(prevJSON), &prev)
+
+	for i, c := range cases {
+		var cur Stats
+		json.Unmarshal([]byte(c.json), &cur)
+
+		if ret := restarted(c.command, &prev, &cur, false); ret != c.desired {
+			t.Errorf("restarted: case %d (%s) should be %v, out %v", i, c.command, c.desired, ret)
+		}
+	}
+}
+
+func TestRestartedSingle(t *testing.T) {
+	prevJSON := `{"backlog": 0, "running": 5, "pool_capacity": 5, "started_at": "2023-01-01T00:00:00Z"}`
+
+	cases := []struct {
+		json    string
+		down    bool
+		desired bool
+	}{
+		{prevJSON, false, false},
+		{prevJSON, true, true},
+		{`{"backlog": 0, "running": 5, "pool_capacity": 5, "started_at": "2023-01-01T00:01:00Z"}`, false, true},
+		// Before Puma 5.0 only a failed poll tells
+		{`{"backlog": 0, "running": 5, "pool_capacity": 5}`, false, false},
+	}
+
+	var prev Stats
+	json.Unmarshal([]byte(prevJSON), &prev)
+
+	for i, c := range cases {
+		var cur Stats
+		json.Unmarshal([]byte(c.json), &cur)
+
+		if ret := restarted("restart", &prev, &cur, c.down); ret != c.desired {
+			t.Errorf("restarted: case %d should be %v, out %v", i, c.desired, ret)
+		}
+	}
+}
+
+func TestSendControlCommand(t *testing.T) {
+	s := pumatest.NewServer(pumatest.Puma5Cluster)
+	defer s.Close()
+	s.SetToken("12345")
+
+	p := pumatestPlugin(s, pumatest.Puma5Cluster)
+	p.Token = "12345"
+
+	if err := p.sendControlCommand("phased-restart"); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Requests("/phased-restart"); n != 1 {
+		t.Errorf("/phased-restart should be requested once, out %d", n)
+	}
+}
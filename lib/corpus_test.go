@@ -0,0 +1,109 @@
+package mppuma
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// Compare ret with the golden file of a fixture, rewriting it with -update
+func checkGolden(t *testing.T, fixture string, ret map[string]float64) {
+	golden := strings.TrimSuffix(fixture, ".json") + ".golden"
+
+	if *update {
+		b, err := json.MarshalIndent(ret, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(golden, append(b, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	b, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var desired map[string]float64
+	if err := json.Unmarshal(b, &desired); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ret) != len(desired) {
+		t.Errorf("len(ret) = %d should be len(desired) = %d", len(ret), len(desired))
+	}
+	for k, v := range desired {
+		if _, ok := ret[k]; !ok {
+			t.Errorf("%s not exists", k)
+		}
+		if ret[k] != v {
+			t.Errorf("%s should be %f, out %f", k, v, ret[k])
+		}
+	}
+	for k := range ret {
+		if _, ok := desired[k]; !ok {
+			t.Errorf("%s should not exist", k)
+		}
+	}
+}
+
+func TestStatsCorpus(t *testing.T) {
+	fixtures, _ := filepath.Glob("testdata/stats/*.json")
+	if len(fixtures) == 0 {
+		t.Fatal("no fixtures in testdata/stats")
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(filepath.Base(fixture), func(t *testing.T) {
+			b, err := os.ReadFile(fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var stats Stats
+			if err := json.Unmarshal(b, &stats); err != nil {
+				t.Fatal(err)
+			}
+
+			var p PumaPlugin
+			p.Single = strings.Contains(fixture, "-single-")
+
+			checkGolden(t, fixture, p.fetchStatsMetrics(&stats))
+		})
+	}
+}
+
+func TestGCStatsCorpus(t *testing.T) {
+	fixtures, _ := filepath.Glob("testdata/gc-stats/*.json")
+	if len(fixtures) == 0 {
+		t.Fatal("no fixtures in testdata/gc-stats")
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(filepath.Base(fixture), func(t *testing.T) {
+			b, err := os.ReadFile(fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var gcStats GCStats
+			if err := json.Unmarshal(b, &gcStats); err != nil {
+				t.Fatal(err)
+			}
+
+			var p PumaPlugin
+			ret, err := p.fetchGCStatsMetrics(&gcStats)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkGolden(t, fixture, ret)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package mppuma
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/rmanzoku/mackerel-plugin-puma/lib/client"
+)
+
+// Exit codes by cause of failure
+const (
+	exitError        = 1
+	exitUnreachable  = 2
+	exitUnauthorized = 3
+	exitNotFound     = 4
+	exitMalformed    = 5
+	exitTimeout      = 6
+)
+
+// Exit code and one-line diagnostic with a remediation hint for err
+func diagnose(err error) (int, string) {
+	var decodeErr *client.DecodeError
+
+	switch {
+	case errors.Is(err, client.ErrTimeout):
+		return exitTimeout, fmt.Sprintf("control server timed out: %s: check the load of Puma or raise -timeout", err)
+	case errors.Is(err, client.ErrUnauthorized):
+		return exitUnauthorized, fmt.Sprintf("token rejected: check control_auth_token in puma.state (%s)", err)
+	case errors.Is(err, client.ErrNotFound):
+		return exitNotFound, fmt.Sprintf("endpoint missing: %s: this Puma is too old for it (/gc-stats needs Puma 3.10.0~)", err)
+	case errors.As(err, &decodeErr):
+		return exitMalformed, fmt.Sprintf("%s: check that -host, -port or -sock point to the Puma control app", err)
+	case errors.Is(err, client.ErrConnectionRefused):
+		return exitUnreachable, fmt.Sprintf("control server unreachable: %s: check -host, -port or -sock and activate_control_app", err)
+	}
+
+	var connErr *client.ConnectionError
+	if errors.As(err, &connErr) {
+		return exitUnreachable, fmt.Sprintf("control server unreachable: %s", err)
+	}
+	return exitError, err.Error()
+}
+
+// controlDown reports whether err means the control server did not answer /stats,
+// as opposed to a response this plugin cannot use
+func controlDown(err error) bool {
+	var connErr *client.ConnectionError
+	var statusErr *client.StatusError
+	return errors.As(err, &connErr) || errors.As(err, &statusErr)
+}
+
+// Print the diagnostic of err and exit with its code
+func exitWithError(err error) {
+	code, msg := diagnose(err)
+	fmt.Fprintln(os.Stderr, msg)
+	os.Exit(code)
+}
+
+// Print the diagnostic of err and carry on
+func warn(err error) {
+	_, msg := diagnose(err)
+	fmt.Fprintln(os.Stderr, msg)
+}
+
+// diagnosingPlugin exits through exitWithError instead of the log.Fatal of the mp helper
+type diagnosingPlugin struct {
+	PumaPlugin
+}
+
+// FetchMetrics interface for mackerelplugin
+func (p diagnosingPlugin) FetchMetrics() (map[string]float64, error) {
+	ret, err := p.PumaPlugin.FetchMetrics()
+	if err != nil {
+		exitWithError(err)
+	}
+	return ret, nil
+}
+
+func (p diagnosingPlugin) fetchMetricsVersions() (map[string]float64, map[string]*Versions, error) {
+	ret, versions, err := p.PumaPlugin.fetchMetricsVersions()
+	if err != nil {
+		exitWithError(err)
+	}
+	return ret, versions, nil
+}
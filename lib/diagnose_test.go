@@ -0,0 +1,60 @@
+package mppuma
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rmanzoku/mackerel-plugin-puma/lib/pumatest"
+)
+
+func TestDiagnose(t *testing.T) {
+	s := pumatest.NewServer(pumatest.Puma3Cluster)
+	defer s.Close()
+	s.SetToken("12345")
+
+	cases := []struct {
+		name    string
+		setup   func(p *PumaPlugin)
+		desired int
+		hint    string
+	}{
+		{"unauthorized", func(p *PumaPlugin) { p.Token = "54321" }, exitUnauthorized, "control_auth_token"},
+		{"not found", func(p *PumaPlugin) { s.SetStatus("/stats", 404) }, exitNotFound, "too old"},
+		{"malformed", func(p *PumaPlugin) { s.SetVersion(pumatest.Version{Stats: "<html>"}) }, exitMalformed, "-host"},
+		{"timeout", func(p *PumaPlugin) { s.SetLatency(100 * time.Millisecond); p.Timeout = 10 * time.Millisecond }, exitTimeout, "-timeout"},
+		{"unreachable", func(p *PumaPlugin) { p.Sock = "/nonexistent/pumactl.sock" }, exitUnreachable, "activate_control_app"},
+	}
+
+	for _, c := range cases {
+		s.SetVersion(pumatest.Puma3Cluster)
+		s.SetStatus("/stats", 0)
+		s.SetLatency(0)
+
+		p := pumatestPlugin(s, pumatest.Puma3Cluster)
+		p.Token = "12345"
+		c.setup(&p)
+
+		_, err := p.getStatsAPI()
+		if err == nil {
+			t.Errorf("%s: getStatsAPI should fail", c.name)
+			continue
+		}
+
+		code, msg := diagnose(err)
+		if code != c.desired {
+			t.Errorf("%s: exit code should be %d, out %d (%s)", c.name, c.desired, code, msg)
+		}
+		if !strings.Contains(msg, c.hint) {
+			t.Errorf("%s: diagnostic should contain %q, out %q", c.name, c.hint, msg)
+		}
+		if strings.Contains(msg, "\n") {
+			t.Errorf("%s: diagnostic should be one line, out %q", c.name, msg)
+		}
+	}
+
+	if code, msg := diagnose(errors.New("unknown")); code != exitError || msg != "unknown" {
+		t.Errorf("diagnose: should be %d unknown, out %d %s", exitError, code, msg)
+	}
+}
@@ -0,0 +1,209 @@
+package mppuma
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// puma 5.6.4 (tcp://0.0.0.0:3000) [myapp]
+	masterTitle = regexp.MustCompile(`^puma (\d\S*) \(([^)]*)\)(?: \[([^\]]*)\])?`)
+	// puma: cluster worker 0: 12345 [myapp]
+	workerTitle = regexp.MustCompile(`^puma: cluster worker \d+: (\d+)`)
+	// Characters not allowed in a metric key
+	invalidKey = regexp.MustCompile(`[^-a-zA-Z0-9_]`)
+)
+
+// A Puma master found in procfs
+type discovered struct {
+	Name string
+	Pid  int
+	Dir  string
+	// Binds in the process title, e.g. tcp://0.0.0.0:3000
+	Binds   []string
+	Workers int
+}
+
+// Find Puma masters from the process titles in procRoot
+func discover(procRoot string) ([]discovered, error) {
+	dirs, err := os.ReadDir(procRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var masters []discovered
+	workers := make(map[int]int)
+
+	for _, d := range dirs {
+		pid, err := strconv.Atoi(d.Name())
+		if err != nil {
+			continue
+		}
+
+		// Processes may exit while scanning
+		b, err := os.ReadFile(filepath.Join(procRoot, d.Name(), "cmdline"))
+		if err != nil {
+			continue
+		}
+		args := strings.FieldsFunc(string(b), func(r rune) bool { return r == 0 })
+		title := strings.TrimSpace(strings.Join(args, " "))
+
+		if m := workerTitle.FindStringSubmatch(title); m != nil {
+			master, _ := strconv.Atoi(m[1])
+			workers[master]++
+			continue
+		}
+
+		m := masterTitle.FindStringSubmatch(title)
+		if m == nil {
+			continue
+		}
+
+		dir, _ := os.Readlink(filepath.Join(procRoot, d.Name(), "cwd"))
+		name := m[3]
+		if name == "" {
+			name = filepath.Base(dir)
+		}
+
+		masters = append(masters, discovered{
+			Name:  invalidKey.ReplaceAllString(name, "_"),
+			Pid:   pid,
+			Dir:   dir,
+			Binds: strings.Split(m[2], ","),
+		})
+	}
+
+	// Masters sharing an app tag or a directory name such as current are told apart by pid
+	names := make(map[string]int)
+	for _, m := range masters {
+		names[m.Name]++
+	}
+	for i := range masters {
+		masters[i].Workers = workers[masters[i].Pid]
+		if names[masters[i].Name] > 1 {
+			masters[i].Name += "_" + strconv.Itoa(masters[i].Pid)
+		}
+	}
+	return masters, nil
+}
+
+// Read the flat YAML puma.state written by Puma
+func readStateFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	state := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		state[strings.TrimSpace(kv[0])] = strings.Trim(strings.TrimSpace(kv[1]), `"'`)
+	}
+	return state, scanner.Err()
+}
+
+// Point p at a control_url such as tcp://127.0.0.1:9293 or unix:///path/to/pumactl.sock
+func (p *PumaPlugin) setControlURL(controlURL string) error {
+	u, err := url.Parse(controlURL)
+	if err != nil {
+		return err
+	}
+
+	switch u.Scheme {
+	case "unix":
+		p.Sock = u.Host + u.Path
+		return nil
+	case "ssl":
+		p.TLS = true
+	case "tcp":
+		p.TLS = false
+	default:
+		return errors.New("unsupported control url " + u.Scheme + "://")
+	}
+
+	p.Sock = ""
+	p.Host, p.Port, err = net.SplitHostPort(u.Host)
+	return err
+}
+
+// Settings for a discovered master, from tmp/pids/puma.state or config/puma.rb in its directory.
+// The process title replaces the command line, so options given to puma itself cannot be read.
+func (p PumaPlugin) discoveredPlugin(d discovered) (PumaPlugin, error) {
+	p.Single = d.Workers == 0
+
+	// A config/puma.rb binding elsewhere belongs to another app or a later release
+	config, err := readPumaConfig(filepath.Join(d.Dir, "config", "puma.rb"))
+	if err != nil || !config.matchBinds(d.Binds) {
+		config = &pumaConfig{Workers: -1, MaxThreads: -1}
+	}
+	if config.MaxThreads > 0 {
+		p.MaxThreads = config.MaxThreads
+	}
+	if config.Workers > 0 {
+		p.ConfiguredWorkers = config.Workers
+	}
+
+	statePath := config.StatePath
+	if statePath == "" {
+		statePath = "tmp/pids/puma.state"
+	}
+	if !filepath.IsAbs(statePath) {
+		statePath = filepath.Join(d.Dir, statePath)
+	}
+
+	// A state file left by another process is ignored
+	var controlURL, token string
+	if state, err := readStateFile(statePath); err == nil && state["pid"] == strconv.Itoa(d.Pid) {
+		controlURL = state["control_url"]
+		token = state["control_auth_token"]
+	}
+
+	if controlURL == "" {
+		controlURL = config.ControlURL
+		if token == "" {
+			token = config.ControlToken
+		}
+	}
+
+	if controlURL == "" {
+		return p, errors.New(d.Name + ": control url not found")
+	}
+	if token != "" {
+		p.Token = token
+		p.TokenFile = ""
+	}
+	err = p.setControlURL(controlURL)
+	return p, err
+}
+
+// Plugin for every master found in procRoot, based on the settings of p
+func (p PumaPlugin) discoverPlugin(procRoot string) multiPlugin {
+	m := multiPlugin{Prefix: p.Prefix}
+
+	masters, err := discover(procRoot)
+	if err != nil {
+		warn(err)
+	}
+
+	for _, d := range masters {
+		instance, err := p.discoveredPlugin(d)
+		if err != nil {
+			warn(err)
+			continue
+		}
+		m.Instances = append(m.Instances, namedPlugin{Name: d.Name, PumaPlugin: instance})
+	}
+	return m
+}
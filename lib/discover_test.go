@@ -0,0 +1,177 @@
+package mppuma
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rmanzoku/mackerel-plugin-puma/lib/pumatest"
+)
+
+// Add a process to a fake procfs
+func writeProc(t *testing.T, procRoot string, pid int, cmdline []string, cwd string) {
+	dir := filepath.Join(procRoot, strconv.Itoa(pid))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cmdline"), []byte(strings.Join(cmdline, "\x00")+"\x00"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cwd != "" {
+		if err := os.Symlink(cwd, filepath.Join(dir, "cwd")); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Write tmp/pids/puma.state of an app
+func writeState(t *testing.T, appDir string, state string) {
+	dir := filepath.Join(appDir, "tmp", "pids")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "puma.state"), []byte(state), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	root := t.TempDir()
+	procRoot := filepath.Join(root, "proc")
+	shop := filepath.Join(root, "shop")
+	blog := filepath.Join(root, "blog")
+
+	writeProc(t, procRoot, 100, []string{"puma 5.6.4 (tcp://0.0.0.0:3000) [shop]"}, shop)
+	writeProc(t, procRoot, 101, []string{"puma: cluster worker 0: 100 [shop]"}, shop)
+	writeProc(t, procRoot, 102, []string{"puma: cluster worker 1: 100 [shop]"}, shop)
+	writeProc(t, procRoot, 200, []string{"puma 3.12.6 (unix:///tmp/blog.sock)"}, blog)
+	writeProc(t, procRoot, 300, []string{"/usr/sbin/sshd", "-D"}, "/")
+	writeProc(t, procRoot, 400, []string{"puma 6.4.2 (tcp://0.0.0.0:4000) [my app.v2]"}, root)
+	// Two untagged releases of an app deployed by Capistrano
+	writeProc(t, procRoot, 500, []string{"puma 6.4.2 (tcp://0.0.0.0:5000)"}, filepath.Join(root, "a", "current"))
+	writeProc(t, procRoot, 600, []string{"puma 6.4.2 (tcp://0.0.0.0:6000)"}, filepath.Join(root, "b", "current"))
+	os.MkdirAll(filepath.Join(procRoot, "self"), 0755)
+
+	masters, err := discover(procRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desired := map[string]discovered{
+		"shop":        {Name: "shop", Pid: 100, Dir: shop, Workers: 2},
+		"blog":        {Name: "blog", Pid: 200, Dir: blog, Workers: 0},
+		"my_app_v2":   {Name: "my_app_v2", Pid: 400, Dir: root, Workers: 0},
+		"current_500": {Name: "current_500", Pid: 500, Dir: filepath.Join(root, "a", "current"), Workers: 0},
+		"current_600": {Name: "current_600", Pid: 600, Dir: filepath.Join(root, "b", "current"), Workers: 0},
+	}
+	if len(masters) != len(desired) {
+		t.Errorf("discover: len(masters) = %d should be %d", len(masters), len(desired))
+	}
+	for _, m := range masters {
+		d, ok := desired[m.Name]
+		if !ok {
+			t.Errorf("%s should not be discovered", m.Name)
+			continue
+		}
+		if m.Pid != d.Pid || m.Dir != d.Dir || m.Workers != d.Workers {
+			t.Errorf("%s should be %+v, out %+v", m.Name, d, m)
+		}
+	}
+}
+
+func TestDiscoveredPlugin(t *testing.T) {
+	appDir := t.TempDir()
+	writeState(t, appDir, `---
+pid: 100
+control_url: unix:///tmp/pumactl.sock
+control_auth_token: 0123abcd
+running_from: "/app"
+`)
+
+	var p PumaPlugin
+	p.Host = "127.0.0.1"
+	p.Port = "9293"
+
+	ret, err := p.discoveredPlugin(discovered{Name: "shop", Pid: 100, Dir: appDir, Workers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret.Sock != "/tmp/pumactl.sock" || ret.Token != "0123abcd" || ret.Single {
+		t.Errorf("state file: out %+v", ret)
+	}
+
+	// Stale state file of another process
+	if _, err := p.discoveredPlugin(discovered{Name: "shop", Pid: 200, Dir: appDir}); err == nil {
+		t.Errorf("stale state file should be ignored")
+	}
+
+	// No state file, control app in config/puma.rb
+	configDir := t.TempDir()
+	os.MkdirAll(filepath.Join(configDir, "config"), 0755)
+	os.WriteFile(filepath.Join(configDir, "config", "puma.rb"), []byte("workers 2\nthreads 1, 5\nactivate_control_app 'tcp://127.0.0.1:9300', { auth_token: 'fromrb' }\n"), 0644)
+
+	ret, err = p.discoveredPlugin(discovered{Name: "blog", Pid: 400, Dir: configDir, Workers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret.Port != "9300" || ret.Token != "fromrb" || ret.MaxThreads != 5 || ret.ConfiguredWorkers != 2 {
+		t.Errorf("config/puma.rb: out %+v", ret)
+	}
+
+	// config/puma.rb of another app, binding elsewhere than the master
+	os.WriteFile(filepath.Join(configDir, "config", "puma.rb"), []byte("bind 'tcp://0.0.0.0:5000'\nactivate_control_app 'tcp://127.0.0.1:9300'\n"), 0644)
+	if _, err := p.discoveredPlugin(discovered{Name: "blog", Pid: 400, Dir: configDir, Binds: []string{"tcp://0.0.0.0:4000"}}); err == nil {
+		t.Errorf("config/puma.rb binding elsewhere should be ignored")
+	}
+}
+
+func TestDiscoverPlugin(t *testing.T) {
+	cluster := pumatest.NewServer(pumatest.Puma5Cluster)
+	defer cluster.Close()
+	cluster.SetToken("12345")
+	single, err := pumatest.NewUnixServer(pumatest.Puma6Single)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer single.Close()
+
+	root := t.TempDir()
+	procRoot := filepath.Join(root, "proc")
+	shop := filepath.Join(root, "shop")
+	blog := filepath.Join(root, "blog")
+
+	writeProc(t, procRoot, 100, []string{"puma 5.6.4 (tcp://0.0.0.0:3000) [shop]"}, shop)
+	writeProc(t, procRoot, 101, []string{"puma: cluster worker 0: 100 [shop]"}, shop)
+	writeState(t, shop, "pid: 100\ncontrol_url: tcp://"+cluster.Host+":"+cluster.Port+"\ncontrol_auth_token: 12345\n")
+	writeProc(t, procRoot, 200, []string{"puma 6.4.2 (tcp://0.0.0.0:4000) [blog]"}, blog)
+	writeState(t, blog, "pid: 200\ncontrol_url: unix://"+single.Sock+"\n")
+
+	var p PumaPlugin
+	m := p.discoverPlugin(procRoot)
+
+	ret, err := m.FetchMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, k := range []string{
+		"shop.control.up",
+		"shop.workers.booted",
+		"shop.backlog.worker0.backlog",
+		"blog.control.up",
+		"blog.running.running",
+	} {
+		if _, ok := ret[k]; !ok {
+			t.Errorf("%s not exists in %v", k, ret)
+		}
+	}
+
+	graphdef := m.GraphDefinition()
+	for _, k := range []string{"#.workers", "#.backlog.#", "#.backlog", "#.control"} {
+		if _, ok := graphdef[k]; !ok {
+			t.Errorf("graph %s not exists", k)
+		}
+	}
+}
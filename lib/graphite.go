@@ -0,0 +1,41 @@
+package mppuma
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	mp "github.com/mackerelio/go-mackerel-plugin"
+)
+
+// Graphite plaintext lines of points, keyed as the mackerel output
+func graphiteLines(prefix string, pts []point, now time.Time) []string {
+	var lines []string
+	ts := strconv.FormatInt(now.Unix(), 10)
+	for _, p := range pts {
+		lines = append(lines, prefix+"."+p.Key+" "+strconv.FormatFloat(p.Value, 'f', -1, 64)+" "+ts)
+	}
+	return lines
+}
+
+// Push the metrics of plugin to a Graphite server over TCP
+func pushGraphite(plugin mp.PluginWithPrefix, addr string, timeout time.Duration) error {
+	metrics, err := plugin.FetchMetrics()
+	if err != nil {
+		return err
+	}
+	lines := graphiteLines(plugin.MetricKeyPrefix(), points(keyGraphs(plugin), metrics), time.Now())
+
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetWriteDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write([]byte(strings.Join(lines, "\n") + "\n")); err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,67 @@
+package mppuma
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rmanzoku/mackerel-plugin-puma/lib/pumatest"
+)
+
+func TestGraphiteLines(t *testing.T) {
+	pts := []point{
+		{Key: "workers.booted", Value: 2},
+		{Key: "backlog.worker0.backlog", Value: 0.5},
+	}
+	desired := []string{
+		"puma.workers.booted 2 1713317056",
+		"puma.backlog.worker0.backlog 0.5 1713317056",
+	}
+
+	ret := graphiteLines("puma", pts, time.Unix(1713317056, 0))
+	if strings.Join(ret, "\n") != strings.Join(desired, "\n") {
+		t.Errorf("graphiteLines should be %v, out %v", desired, ret)
+	}
+}
+
+func TestPushGraphite(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			received <- ""
+			return
+		}
+		defer conn.Close()
+		b, _ := io.ReadAll(conn)
+		received <- string(b)
+	}()
+
+	s := pumatest.NewServer(pumatest.Puma6Single)
+	defer s.Close()
+	p := pumatestPlugin(s, pumatest.Puma6Single)
+	p.WithGC = false
+	p.Prefix = "app1.puma"
+
+	if err := pushGraphite(p, l.Addr().String(), time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	body := <-received
+	if !strings.HasSuffix(body, "\n") {
+		t.Errorf("graphite payload should end with a newline")
+	}
+	for _, want := range []string{"app1.puma.control.up 1 ", "app1.puma.threads.capacity "} {
+		if !strings.Contains(body, want) {
+			t.Errorf("%q should be sent, out %q", want, body)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package mppuma
+
+import (
+	"regexp"
+	"strings"
+
+	mp "github.com/mackerelio/go-mackerel-plugin"
+)
+
+// Puma in single mode reports no workers in /stats
+func (p PumaPlugin) detectMode(stats *Stats) PumaPlugin {
+	p.Single = stats.Workers == 0 && len(stats.WorkerStatus) == 0
+	return p
+}
+
+// Graphs of the metrics stats can produce, with GC graphs only if /gc-stats answered
+func (p PumaPlugin) probedGraphDefinition(stats *Stats, gcStats bool) map[string]mp.Graphs {
+	p = p.detectMode(stats)
+	graphdef := p.staticGraphDefinition()
+
+	maxThreads := p.MaxThreads > 0 || stats.MaxThreads > 0
+	for _, v := range stats.WorkerStatus {
+		if v.LastStatus.MaxThreads > 0 {
+			maxThreads = true
+		}
+	}
+	if !maxThreads {
+		delete(graphdef, "threads")
+	}
+
+	// requests_count and started_at are reported since Puma 5.0
+	requests := stats.RequestsCount != nil
+	for _, v := range stats.WorkerStatus {
+		if v.LastStatus.RequestsCount != nil {
+			requests = true
+		}
+	}
+	if !requests {
+		delete(graphdef, "requests")
+		delete(graphdef, "requests.#")
+	}
+	if stats.StartedAt.IsZero() {
+		for _, key := range []string{"uptime", "worker_age", "age.#"} {
+			delete(graphdef, key)
+		}
+	}
+
+	if stats.Versions == nil {
+		delete(graphdef, "version")
+	}
+
+	if !gcStats {
+		for key := range graphdefGC {
+			delete(graphdef, key)
+		}
+	}
+	return graphdef
+}
+
+// Metrics matched by the graphs of graphdef, and the meta keys
+func probedMetrics(graphdef map[string]mp.Graphs, metrics map[string]float64) map[string]float64 {
+	names := make(map[string]bool)
+	var wildcards []*regexp.Regexp
+	for key, graph := range graphdef {
+		for _, metric := range graph.Metrics {
+			if strings.ContainsAny(key+metric.Name, "*#") {
+				wildcards = append(wildcards, wildcardKey(key+"."+metric.Name))
+			} else {
+				names[metric.Name] = true
+			}
+		}
+	}
+
+	ret := make(map[string]float64)
+	for k, v := range metrics {
+		if names[k] || strings.HasPrefix(k, metaPrefix) {
+			ret[k] = v
+			continue
+		}
+		for _, re := range wildcards {
+			if re.MatchString(k) {
+				ret[k] = v
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// Graphs to match metric keys against without probing the server, in either mode.
+// A graph of both modes such as saturation keeps the metrics of each.
+func (p PumaPlugin) keyGraphDefinition() map[string]mp.Graphs {
+	p.Single = false
+	ret := p.staticGraphDefinition()
+	p.Single = true
+	for key, single := range p.staticGraphDefinition() {
+		cluster, ok := ret[key]
+		if !ok {
+			ret[key] = single
+			continue
+		}
+
+		names := make(map[string]bool)
+		for _, m := range cluster.Metrics {
+			names[m.Name] = true
+		}
+		metrics := append([]mp.Metrics{}, cluster.Metrics...)
+		for _, m := range single.Metrics {
+			if !names[m.Name] {
+				metrics = append(metrics, m)
+			}
+		}
+		cluster.Metrics = metrics
+		ret[key] = cluster
+	}
+	return ret
+}
+
+// Plugins which can match metric keys without probing the server
+type keyGrapher interface {
+	keyGraphDefinition() map[string]mp.Graphs
+}
+
+// Graphs to match the metrics of plugin against
+func keyGraphs(plugin mp.Plugin) map[string]mp.Graphs {
+	if g, ok := plugin.(keyGrapher); ok {
+		return g.keyGraphDefinition()
+	}
+	return plugin.GraphDefinition()
+}
+
+// valuesPlugin matches metric keys without probing the server, for runs printing values
+type valuesPlugin struct {
+	mp.PluginWithPrefix
+}
+
+// GraphDefinition interface for mackerelplugin
+func (p valuesPlugin) GraphDefinition() map[string]mp.Graphs {
+	return keyGraphs(p.PluginWithPrefix)
+}
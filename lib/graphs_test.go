@@ -0,0 +1,166 @@
+package mppuma
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/rmanzoku/mackerel-plugin-puma/lib/pumatest"
+)
+
+func TestGraphDefinitionProbed(t *testing.T) {
+	cases := []struct {
+		version pumatest.Version
+		present []string
+		absent  []string
+	}{
+		{pumatest.Puma3Single, []string{"control", "backlog", "gc.count"}, []string{"backlog.#", "threads", "requests", "uptime", "version"}},
+		{pumatest.Puma3Cluster, []string{"workers", "backlog.#"}, []string{"backlog", "threads", "requests.#", "age.#", "version"}},
+		{pumatest.Puma5Cluster, []string{"workers", "threads", "requests.#", "uptime", "age.#"}, []string{"backlog", "version"}},
+		{pumatest.Puma6Single, []string{"backlog", "threads", "requests", "uptime", "version"}, []string{"workers", "age.#"}},
+		{pumatest.Puma6Cluster, []string{"workers", "threads", "requests.#", "uptime", "version", "gc.count"}, []string{"backlog"}},
+	}
+
+	for _, c := range cases {
+		s := pumatest.NewServer(c.version)
+
+		// -single is not given, the mode comes from /stats
+		p := pumatestPlugin(s, c.version)
+		p.Single = false
+		graphdef := p.GraphDefinition()
+
+		for _, key := range c.present {
+			if _, ok := graphdef[key]; !ok {
+				t.Errorf("%s: %s graph should be defined", c.version.Name, key)
+			}
+		}
+		for _, key := range c.absent {
+			if _, ok := graphdef[key]; ok {
+				t.Errorf("%s: %s graph should not be defined", c.version.Name, key)
+			}
+		}
+
+		s.Close()
+	}
+}
+
+func TestGraphDefinitionProbedWithoutGCStats(t *testing.T) {
+	s := pumatest.NewServer(pumatest.Puma6Cluster)
+	defer s.Close()
+	s.SetStatus("/gc-stats", http.StatusNotFound)
+
+	p := pumatestPlugin(s, pumatest.Puma6Cluster)
+	graphdef := p.GraphDefinition()
+
+	for key := range graphdefGC {
+		if _, ok := graphdef[key]; ok {
+			t.Errorf("%s graph should not be defined without /gc-stats", key)
+		}
+	}
+	if _, ok := graphdef["workers"]; !ok {
+		t.Errorf("workers graph should be defined")
+	}
+}
+
+func TestGraphDefinitionUnreachable(t *testing.T) {
+	s := pumatest.NewServer(pumatest.Puma6Cluster)
+	p := pumatestPlugin(s, pumatest.Puma6Cluster)
+	s.Close()
+
+	// Every graph of the mode given by -single
+	if len(p.GraphDefinition()) != len(p.staticGraphDefinition()) {
+		t.Errorf("GraphDefinition of an unreachable server should be the static graphs")
+	}
+}
+
+func TestFetchMetricsDetectMode(t *testing.T) {
+	s := pumatest.NewServer(pumatest.Puma6Single)
+	defer s.Close()
+
+	p := pumatestPlugin(s, pumatest.Puma6Single)
+	p.Single = false
+
+	ret, err := p.FetchMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ret["running"]; !ok {
+		t.Errorf("running should be fetched from a single mode server without -single")
+	}
+	if _, ok := flattenMetrics(keyGraphs(p), ret)["running.running"]; !ok {
+		t.Errorf("running.running should be matched by the key graphs")
+	}
+}
+
+func TestProbedMetrics(t *testing.T) {
+	var p PumaPlugin
+	graphdef := p.staticGraphDefinition()
+	delete(graphdef, "requests.#")
+
+	metrics := map[string]float64{
+		"booted":                    2,
+		"backlog.worker0.backlog":   1,
+		"requests.worker0.requests": 0,
+		"meta.pid.worker0":          1234,
+		"unknown":                   1,
+	}
+	ret := probedMetrics(graphdef, metrics)
+
+	for _, k := range []string{"booted", "backlog.worker0.backlog", "meta.pid.worker0"} {
+		if _, ok := ret[k]; !ok {
+			t.Errorf("probedMetrics should keep %s", k)
+		}
+	}
+	for _, k := range []string{"requests.worker0.requests", "unknown"} {
+		if _, ok := ret[k]; ok {
+			t.Errorf("probedMetrics should drop %s", k)
+		}
+	}
+}
+
+func TestFetchMetricsProbed(t *testing.T) {
+	for _, v := range pumatest.Versions {
+		s := pumatest.NewServer(v)
+
+		p := pumatestPlugin(s, v)
+		p.Single = false
+		ret, err := p.FetchMetrics()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Every metric posted has a graph of GraphDefinition
+		graphed := probedMetrics(p.GraphDefinition(), ret)
+		for k := range ret {
+			if _, ok := graphed[k]; !ok {
+				t.Errorf("%s: %s has no graph in GraphDefinition", v.Name, k)
+			}
+		}
+
+		s.Close()
+	}
+}
+
+func TestKeyGraphsCluster(t *testing.T) {
+	s := pumatest.NewServer(pumatest.Puma3Cluster)
+	defer s.Close()
+
+	p := pumatestPlugin(s, pumatest.Puma3Cluster)
+	metrics, err := p.FetchMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// What every output posts, not only what fetchStatsMetrics computes
+	posted := flattenMetrics(keyGraphs(valuesPlugin{diagnosingPlugin{p}}), metrics)
+	for _, k := range []string{
+		"saturation.pool_exhausted",
+		"saturation.backlog_nonzero",
+		"saturation.workers_exhausted",
+		"saturation.workers_with_backlog",
+		"workers.booted",
+	} {
+		if _, ok := posted[k]; !ok {
+			t.Errorf("%s should be posted, out %v", k, posted)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package mppuma
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	mp "github.com/mackerelio/go-mackerel-plugin"
+)
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+)
+
+// InfluxDB line protocol of points, a measurement per graph such as puma_workers with a field per metric,
+// tagged by instance, worker index and worker pid
+func influxLines(prefix string, pts []point, metrics map[string]float64, now time.Time) []string {
+	type series struct {
+		measurement string
+		tags        string
+	}
+	fields := make(map[series][]string)
+	var order []series
+
+	for _, p := range pts {
+		name := strings.Split(p.Name, ".")
+		s := series{measurement: influxMeasurementEscaper.Replace(prefix + "_" + name[0])}
+
+		tags := make(map[string]string)
+		for k, v := range p.Tags {
+			tags[k] = v
+		}
+		if pid, ok := workerPid(metrics, p); ok {
+			tags["pid"] = pid
+		}
+		var keys []string
+		for k := range tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			s.tags += "," + influxTagEscaper.Replace(k) + "=" + influxTagEscaper.Replace(tags[k])
+		}
+
+		if _, ok := fields[s]; !ok {
+			order = append(order, s)
+		}
+		field := influxTagEscaper.Replace(name[len(name)-1]) + "=" + strconv.FormatFloat(p.Value, 'f', -1, 64)
+		fields[s] = append(fields[s], field)
+	}
+
+	ts := strconv.FormatInt(now.UnixNano(), 10)
+	var lines []string
+	for _, s := range order {
+		lines = append(lines, s.measurement+s.tags+" "+strings.Join(fields[s], ",")+" "+ts)
+	}
+	return lines
+}
+
+// Print the metrics of plugin in line protocol, or post them to a write endpoint such as
+// http://localhost:8086/write?db=puma
+func pushInflux(plugin mp.PluginWithPrefix, url string, timeout time.Duration) error {
+	metrics, err := plugin.FetchMetrics()
+	if err != nil {
+		return err
+	}
+	pts := points(keyGraphs(plugin), metrics)
+	body := strings.Join(influxLines(plugin.MetricKeyPrefix(), pts, metrics, time.Now()), "\n") + "\n"
+
+	if url == "" {
+		_, err := io.WriteString(os.Stdout, body)
+		return err
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Post(url, "text/plain; charset=utf-8", bytes.NewBufferString(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s %s", url, resp.Status, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
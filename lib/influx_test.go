@@ -0,0 +1,62 @@
+package mppuma
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rmanzoku/mackerel-plugin-puma/lib/pumatest"
+)
+
+func TestInfluxLines(t *testing.T) {
+	m := multiPlugin{Instances: []namedPlugin{{Name: "myapp", PumaPlugin: PumaPlugin{WithGC: true}}}}
+	metrics := map[string]float64{
+		"myapp.workers.booted":          2,
+		"myapp.workers.configured":      2,
+		"myapp.backlog.worker0.backlog": 1,
+		"myapp.running.worker0.running": 5,
+		"myapp.gc.count.total":          12,
+		"myapp.meta.pid.worker0":        1234,
+	}
+
+	desired := []string{
+		"puma_backlog,instance=myapp,pid=1234,worker=0 backlog=1 1713317056000000000",
+		"puma_gc,instance=myapp total=12 1713317056000000000",
+		"puma_running,instance=myapp,pid=1234,worker=0 running=5 1713317056000000000",
+		"puma_workers,instance=myapp booted=2,configured=2 1713317056000000000",
+	}
+
+	ret := influxLines("puma", points(m.GraphDefinition(), metrics), metrics, time.Unix(1713317056, 0))
+	if strings.Join(ret, "\n") != strings.Join(desired, "\n") {
+		t.Errorf("influxLines should be\n%s\nout\n%s", strings.Join(desired, "\n"), strings.Join(ret, "\n"))
+	}
+}
+
+func TestPushInflux(t *testing.T) {
+	received := make(chan string, 1)
+	influx := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		received <- r.URL.RawQuery + "\n" + string(b)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer influx.Close()
+
+	s := pumatest.NewServer(pumatest.Puma6Cluster)
+	defer s.Close()
+	p := pumatestPlugin(s, pumatest.Puma6Cluster)
+	p.WithGC = false
+
+	if err := pushInflux(p, influx.URL+"/write?db=puma", time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	body := <-received
+	for _, want := range []string{"db=puma\n", "puma_control response_time_ms=", "puma_workers booted=", "puma_backlog,pid="} {
+		if !strings.Contains(body, want) {
+			t.Errorf("%q should be posted, out %q", want, body)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package mppuma
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	mp "github.com/mackerelio/go-mackerel-plugin"
+)
+
+// Keys of metrics describing the others rather than graphed, e.g. meta.pid.worker0
+const metaPrefix = "meta."
+
+// Regexp of the metric keys matched by a wildcard graph key such as backlog.#.backlog,
+// capturing the wildcard segments
+func wildcardKey(key string) *regexp.Regexp {
+	key = regexp.QuoteMeta(key)
+	key = strings.NewReplacer(`\*`, `([-a-zA-Z0-9_]+)`, "#", `([-a-zA-Z0-9_]+)`).Replace(key)
+	return regexp.MustCompile(`\A` + key + `\z`)
+}
+
+// A metric value with its graph, for outputs other than mackerel-agent
+type point struct {
+	// Key as mackerel-agent names it (without the prefix), e.g. backlog.worker0.backlog
+	Key string
+	// Key without the wildcard segments, e.g. backlog.backlog
+	Name string
+	// Wildcard segments: instance for the leading one of -discover, worker for the others
+	Tags map[string]string
+	// Worker segment of Key, e.g. worker0
+	Worker string
+	Value  float64
+	Diff   bool
+	Unit   string
+}
+
+// Values of metrics matched against graphdef, sorted by key
+func points(graphdef map[string]mp.Graphs, metrics map[string]float64) []point {
+	var ret []point
+
+	for key, graph := range graphdef {
+		for _, metric := range graph.Metrics {
+			p := point{Diff: metric.Diff, Unit: graph.Unit}
+
+			if !strings.ContainsAny(key+metric.Name, "*#") {
+				if v, ok := metrics[metric.Name]; ok {
+					p.Key = key + "." + metric.Name
+					p.Name = p.Key
+					p.Value = v
+					ret = append(ret, p)
+				}
+				continue
+			}
+
+			var name []string
+			for _, s := range strings.Split(key+"."+metric.Name, ".") {
+				if s != "#" && s != "*" {
+					name = append(name, s)
+				}
+			}
+			p.Name = strings.Join(name, ".")
+
+			re := wildcardKey(key + "." + metric.Name)
+			for k, v := range metrics {
+				m := re.FindStringSubmatch(k)
+				if m == nil {
+					continue
+				}
+				p.Key = k
+				p.Value = v
+				p.Tags, p.Worker = wildcardTags(key, m[1:])
+				ret = append(ret, p)
+			}
+		}
+	}
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Key < ret[j].Key })
+	return ret
+}
+
+// Name the segments matched by the wildcards of graph key, returning the worker segment too
+func wildcardTags(key string, segments []string) (map[string]string, string) {
+	tags := make(map[string]string)
+	worker := ""
+	for i, s := range segments {
+		if i == 0 && strings.HasPrefix(key, "#.") {
+			tags["instance"] = s
+			continue
+		}
+		worker = s
+		tags["worker"] = strings.TrimPrefix(s, "worker")
+	}
+	return tags, worker
+}
+
+// Value of the meta key name for the instance of p, e.g. pid.worker0
+func metaValue(metrics map[string]float64, p point, name string) (float64, bool) {
+	key := metaPrefix + name
+	if instance, ok := p.Tags["instance"]; ok {
+		key = instance + "." + key
+	}
+	v, ok := metrics[key]
+	return v, ok
+}
+
+// Pid of the worker of p, from the meta keys of metrics
+func workerPid(metrics map[string]float64, p point) (string, bool) {
+	if p.Worker == "" {
+		return "", false
+	}
+	pid, ok := metaValue(metrics, p, "pid."+p.Worker)
+	if !ok {
+		return "", false
+	}
+	return strconv.Itoa(int(pid)), true
+}
+
+// Start of the process counting p, the worker of p or else the master, in unix seconds
+func startedAt(metrics map[string]float64, p point) (float64, bool) {
+	if p.Worker != "" {
+		return metaValue(metrics, p, "started_at."+p.Worker)
+	}
+	return metaValue(metrics, p, "started_at")
+}
+
+// Metrics keyed as mackerel-agent names them (without the prefix), e.g. workers.booted
+func flattenMetrics(graphdef map[string]mp.Graphs, metrics map[string]float64) map[string]float64 {
+	ret := make(map[string]float64)
+	for _, p := range points(graphdef, metrics) {
+		ret[p.Key] = p.Value
+	}
+	return ret
+}
@@ -0,0 +1,53 @@
+package mppuma
+
+import "testing"
+
+func TestFlattenMetrics(t *testing.T) {
+	metrics := map[string]float64{
+		"configured":                    2,
+		"booted":                        2,
+		"up":                            1,
+		"backlog.worker0.backlog":       1,
+		"running.worker0.running":       5,
+		"running.worker0.pool_capacity": 4,
+	}
+
+	desired := map[string]float64{
+		"workers.configured":      2,
+		"workers.booted":          2,
+		"control.up":              1,
+		"backlog.worker0.backlog": 1,
+		"running.worker0.running": 5,
+	}
+
+	ret := flattenMetrics(mergeGraphs(graphdefControl, graphdefStats), metrics)
+
+	if len(ret) != len(desired) {
+		t.Errorf("flattenMetrics: len(ret) = %d should be len(desired) = %d: %v", len(ret), len(desired), ret)
+	}
+	for k, v := range desired {
+		if ret[k] != v {
+			t.Errorf("%s should be %f, out %f", k, v, ret[k])
+		}
+	}
+}
+
+func TestPoints(t *testing.T) {
+	m := multiPlugin{Instances: []namedPlugin{{Name: "myapp"}}}
+	metrics := map[string]float64{
+		"myapp.workers.booted":          2,
+		"myapp.backlog.worker3.backlog": 1,
+	}
+
+	pts := points(m.GraphDefinition(), metrics)
+
+	if len(pts) != 2 {
+		t.Fatalf("points: len(pts) = %d should be 2: %v", len(pts), pts)
+	}
+	if pts[0].Name != "backlog.backlog" || pts[0].Tags["instance"] != "myapp" || pts[0].Tags["worker"] != "3" {
+		t.Errorf("backlog point should be backlog.backlog tagged instance:myapp worker:3, out %v", pts[0])
+	}
+	if pts[1].Name != "workers.booted" || pts[1].Tags["instance"] != "myapp" {
+		t.Errorf("workers point should be workers.booted tagged instance:myapp, out %v", pts[1])
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package mppuma
+
+import (
+	"os"
+	"syscall"
+)
+
+// Block until f is locked exclusively, released when f is closed
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
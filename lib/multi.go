@@ -0,0 +1,97 @@
+package mppuma
+
+import (
+	"strings"
+	"sync"
+
+	mp "github.com/mackerelio/go-mackerel-plugin"
+)
+
+// A Puma instance monitored under its name
+type namedPlugin struct {
+	Name string
+	PumaPlugin
+}
+
+// multiPlugin monitors several instances, with metrics keyed by instance name first
+type multiPlugin struct {
+	Prefix    string
+	Instances []namedPlugin
+}
+
+// FetchMetrics interface for mackerelplugin
+func (m multiPlugin) FetchMetrics() (map[string]float64, error) {
+	ret, _, err := m.fetchMetricsVersions()
+	return ret, err
+}
+
+// Metrics with the versions of /stats keyed by instance name
+func (m multiPlugin) fetchMetricsVersions() (map[string]float64, map[string]*Versions, error) {
+	ret := make(map[string]float64)
+	versions := make(map[string]*Versions)
+
+	// Instances are fetched concurrently so that -samples takes the same time for all of them
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, i := range m.Instances {
+		wg.Add(1)
+		go func(i namedPlugin) {
+			defer wg.Done()
+
+			// One failing instance should not hide the others
+			metrics, v, err := i.fetchMetricsVersions()
+			if err != nil {
+				warn(err)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if v[""] != nil {
+				versions[i.Name] = v[""]
+			}
+			for k, v := range flattenMetrics(i.keyGraphDefinition(), metrics) {
+				ret[i.Name+"."+k] = v
+			}
+			for k, v := range metrics {
+				if strings.HasPrefix(k, metaPrefix) {
+					ret[i.Name+"."+k] = v
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	return ret, versions, nil
+}
+
+// GraphDefinition interface for mackerelplugin
+func (m multiPlugin) GraphDefinition() map[string]mp.Graphs {
+	ret := make(map[string]mp.Graphs)
+
+	for _, i := range m.Instances {
+		for k, v := range i.GraphDefinition() {
+			ret["#."+k] = v
+		}
+	}
+	return ret
+}
+
+// Graphs to match the metric keys of every instance against
+func (m multiPlugin) keyGraphDefinition() map[string]mp.Graphs {
+	ret := make(map[string]mp.Graphs)
+
+	for _, i := range m.Instances {
+		for k, v := range i.keyGraphDefinition() {
+			ret["#."+k] = v
+		}
+	}
+	return ret
+}
+
+// MetricKeyPrefix interface for PluginWithPrefix
+func (m multiPlugin) MetricKeyPrefix() string {
+	if m.Prefix == "" {
+		m.Prefix = "puma"
+	}
+	return m.Prefix
+}
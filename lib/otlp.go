@@ -0,0 +1,222 @@
+package mppuma
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	mp "github.com/mackerelio/go-mackerel-plugin"
+)
+
+// Cumulative counters graphed as raw values for mackerel-agent, exported as monotonic sums
+var otlpCounters = map[string]bool{
+	"gc.count.total": true,
+	"gc.count.minor": true,
+	"gc.count.major": true,
+}
+
+// OTLP/HTTP JSON encoding of ExportMetricsServiceRequest
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name  string     `json:"name"`
+	Unit  string     `json:"unit,omitempty"`
+	Gauge *otlpGauge `json:"gauge,omitempty"`
+	Sum   *otlpSum   `json:"sum,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+	// 2 is AGGREGATION_TEMPORALITY_CUMULATIVE
+	AggregationTemporality int  `json:"aggregationTemporality"`
+	IsMonotonic            bool `json:"isMonotonic"`
+}
+
+type otlpDataPoint struct {
+	Attributes []otlpAttribute `json:"attributes,omitempty"`
+	// Start of the process counting a sum, so that collectors can tell a restart from a drop
+	StartTimeUnixNano string  `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string  `json:"timeUnixNano"`
+	AsDouble          float64 `json:"asDouble"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func otlpAttributes(attrs map[string]string) []otlpAttribute {
+	var keys []string
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var ret []otlpAttribute
+	for _, k := range keys {
+		ret = append(ret, otlpAttribute{Key: k, Value: otlpValue{StringValue: attrs[k]}})
+	}
+	return ret
+}
+
+// Export request of points, a resource per instance with its versions, and the worker and pid as data point attributes
+func otlpMetrics(prefix, host string, pts []point, metrics map[string]float64, versions map[string]*Versions, now time.Time) otlpRequest {
+	ts := strconv.FormatInt(now.UnixNano(), 10)
+
+	resources := make(map[string]*otlpResourceMetrics)
+	var instances []string
+	byName := make(map[string]map[string]*otlpMetric)
+
+	for _, p := range pts {
+		instance := p.Tags["instance"]
+		if _, ok := resources[instance]; !ok {
+			attrs := map[string]string{"host.name": host, "service.name": prefix}
+			if instance != "" {
+				attrs["service.instance.id"] = instance
+			}
+			for k, v := range versionAttributes(versions[instance]) {
+				attrs[k] = v
+			}
+			resources[instance] = &otlpResourceMetrics{
+				Resource:     otlpResource{Attributes: otlpAttributes(attrs)},
+				ScopeMetrics: []otlpScopeMetrics{{Scope: otlpScope{Name: "mackerel-plugin-puma"}}},
+			}
+			byName[instance] = make(map[string]*otlpMetric)
+			instances = append(instances, instance)
+		}
+
+		attrs := make(map[string]string)
+		if worker, ok := p.Tags["worker"]; ok {
+			attrs["worker"] = worker
+		}
+		if pid, ok := workerPid(metrics, p); ok {
+			attrs["pid"] = pid
+		}
+		dp := otlpDataPoint{Attributes: otlpAttributes(attrs), TimeUnixNano: ts, AsDouble: p.Value}
+
+		name := prefix + "." + p.Name
+		m, ok := byName[instance][name]
+		if !ok {
+			m = &otlpMetric{Name: name}
+			if p.Unit == "percentage" {
+				m.Unit = "%"
+			}
+			if p.Diff || otlpCounters[p.Name] {
+				m.Sum = &otlpSum{AggregationTemporality: 2, IsMonotonic: true}
+			} else {
+				m.Gauge = &otlpGauge{}
+			}
+			byName[instance][name] = m
+		}
+		if m.Sum != nil {
+			if started, ok := startedAt(metrics, p); ok {
+				dp.StartTimeUnixNano = strconv.FormatInt(int64(started)*int64(time.Second), 10)
+			}
+			m.Sum.DataPoints = append(m.Sum.DataPoints, dp)
+		} else {
+			m.Gauge.DataPoints = append(m.Gauge.DataPoints, dp)
+		}
+	}
+
+	var req otlpRequest
+	for _, instance := range instances {
+		r := resources[instance]
+		var names []string
+		for name := range byName[instance] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			r.ScopeMetrics[0].Metrics = append(r.ScopeMetrics[0].Metrics, *byName[instance][name])
+		}
+		req.ResourceMetrics = append(req.ResourceMetrics, *r)
+	}
+	return req
+}
+
+// Post the metrics of plugin to an OTLP/HTTP collector endpoint such as http://localhost:4318/v1/metrics,
+// with headers as name=value pairs separated by commas
+func pushOTLP(plugin mp.PluginWithPrefix, endpoint, headers string, timeout time.Duration) error {
+	var metrics map[string]float64
+	var versions map[string]*Versions
+	var err error
+	if v, ok := plugin.(versionsFetcher); ok {
+		metrics, versions, err = v.fetchMetricsVersions()
+	} else {
+		metrics, err = plugin.FetchMetrics()
+	}
+	if err != nil {
+		return err
+	}
+	host, _ := os.Hostname()
+	req := otlpMetrics(plugin.MetricKeyPrefix(), host, points(keyGraphs(plugin), metrics), metrics, versions, time.Now())
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	for _, h := range strings.Split(headers, ",") {
+		if strings.TrimSpace(h) == "" {
+			continue
+		}
+		kv := strings.SplitN(h, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("-otlp-headers %q should be name=value", h)
+		}
+		httpReq.Header.Set(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s %s", endpoint, resp.Status, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
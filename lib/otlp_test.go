@@ -0,0 +1,151 @@
+package mppuma
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rmanzoku/mackerel-plugin-puma/lib/client"
+	"github.com/rmanzoku/mackerel-plugin-puma/lib/pumatest"
+)
+
+func TestOTLPMetrics(t *testing.T) {
+	m := multiPlugin{Instances: []namedPlugin{{Name: "myapp", PumaPlugin: PumaPlugin{WithGC: true}}}}
+	metrics := map[string]float64{
+		"myapp.workers.booted":            2,
+		"myapp.backlog.worker0.backlog":   1,
+		"myapp.requests.worker0.requests": 100,
+		"myapp.gc.count.total":            12,
+		"myapp.version.puma":              60402,
+		"myapp.meta.pid.worker0":          1234,
+		"myapp.meta.started_at":           1713310000,
+		"myapp.meta.started_at.worker0":   1713316000,
+	}
+
+	versions := map[string]*Versions{
+		"myapp": {Puma: "6.5.0.pre1", Ruby: client.RubyVersion{Engine: "truffleruby", Version: "3.2.2", Patchlevel: -1}},
+	}
+
+	req := otlpMetrics("puma", "web1", points(m.keyGraphDefinition(), metrics), metrics, versions, time.Unix(1713317056, 0))
+
+	if len(req.ResourceMetrics) != 1 {
+		t.Fatalf("resourceMetrics should be 1, out %d", len(req.ResourceMetrics))
+	}
+	rm := req.ResourceMetrics[0]
+
+	resource := make(map[string]string)
+	for _, a := range rm.Resource.Attributes {
+		resource[a.Key] = a.Value.StringValue
+	}
+	if resource["host.name"] != "web1" || resource["service.instance.id"] != "myapp" || resource["puma.version"] != "6.5.0.pre1" {
+		t.Errorf("resource attributes should have host.name, service.instance.id and puma.version, out %v", resource)
+	}
+	if resource["process.runtime.name"] != "truffleruby" || resource["process.runtime.version"] != "3.2.2" {
+		t.Errorf("resource attributes should have the Ruby engine and version, out %v", resource)
+	}
+
+	byName := make(map[string]otlpMetric)
+	for _, metric := range rm.ScopeMetrics[0].Metrics {
+		byName[metric.Name] = metric
+	}
+
+	if m := byName["puma.workers.booted"]; m.Gauge == nil {
+		t.Errorf("puma.workers.booted should be a gauge")
+	}
+	for _, name := range []string{"puma.requests.requests", "puma.gc.count.total"} {
+		if m := byName[name]; m.Sum == nil || !m.Sum.IsMonotonic || m.Sum.AggregationTemporality != 2 {
+			t.Errorf("%s should be a cumulative monotonic sum, out %+v", name, m)
+		}
+	}
+
+	// Sums start with the worker counting them, or the master for master-wide counters
+	cases := []struct {
+		name    string
+		desired string
+	}{
+		{"puma.requests.requests", "1713316000000000000"},
+		{"puma.gc.count.total", "1713310000000000000"},
+	}
+	for _, c := range cases {
+		if m := byName[c.name]; m.Sum == nil || len(m.Sum.DataPoints) != 1 || m.Sum.DataPoints[0].StartTimeUnixNano != c.desired {
+			t.Errorf("%s should start at %s, out %+v", c.name, c.desired, m.Sum)
+		}
+	}
+
+	backlog := byName["puma.backlog.backlog"]
+	if backlog.Gauge == nil || len(backlog.Gauge.DataPoints) != 1 {
+		t.Fatalf("puma.backlog.backlog should be a gauge with 1 data point, out %+v", backlog)
+	}
+	dp := backlog.Gauge.DataPoints[0]
+	attrs := make(map[string]string)
+	for _, a := range dp.Attributes {
+		attrs[a.Key] = a.Value.StringValue
+	}
+	if attrs["worker"] != "0" || attrs["pid"] != "1234" {
+		t.Errorf("data point attributes should be worker=0 pid=1234, out %v", attrs)
+	}
+	if dp.TimeUnixNano != "1713317056000000000" || dp.StartTimeUnixNano != "" || dp.AsDouble != 1 {
+		t.Errorf("data point should be 1 at 1713317056000000000, out %+v", dp)
+	}
+}
+
+func TestPushOTLP(t *testing.T) {
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	ch := make(chan received, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		ch <- received{r.Header, b}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer collector.Close()
+
+	s := pumatest.NewServer(pumatest.Puma6Cluster)
+	defer s.Close()
+	p := pumatestPlugin(s, pumatest.Puma6Cluster)
+
+	if err := pushOTLP(p, collector.URL+"/v1/metrics", "x-api-key=secret", time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	r := <-ch
+	if r.header.Get("Content-Type") != "application/json" || r.header.Get("X-Api-Key") != "secret" {
+		t.Errorf("headers should have Content-Type and X-Api-Key, out %v", r.header)
+	}
+
+	var req otlpRequest
+	if err := json.Unmarshal(r.body, &req); err != nil {
+		t.Fatal(err)
+	}
+	resource := make(map[string]string)
+	for _, a := range req.ResourceMetrics[0].Resource.Attributes {
+		resource[a.Key] = a.Value.StringValue
+	}
+	if resource["puma.version"] != "6.4.2" || resource["process.runtime.description"] != "ruby 3.2.2p53" {
+		t.Errorf("resource attributes should have the versions of /stats, out %v", resource)
+	}
+
+	names := make(map[string]bool)
+	for _, m := range req.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		names[m.Name] = true
+		if m.Sum == nil {
+			continue
+		}
+		for _, dp := range m.Sum.DataPoints {
+			if dp.StartTimeUnixNano == "" {
+				t.Errorf("%s should have startTimeUnixNano from started_at, out %+v", m.Name, dp)
+			}
+		}
+	}
+	for _, name := range []string{"puma.control.up", "puma.running.running", "puma.requests.requests", "puma.gc.count.total"} {
+		if !names[name] {
+			t.Errorf("%s should be exported, out %v", name, names)
+		}
+	}
+}
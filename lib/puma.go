@@ -1,7 +1,11 @@
 package mppuma
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"os"
+	"time"
 
 	mp "github.com/mackerelio/go-mackerel-plugin"
 )
@@ -15,6 +19,36 @@ type PumaPlugin struct {
 	Token  string
 	Single bool
 	WithGC bool
+
+	// Read the token from this file instead of Token
+	TokenFile string
+	// Send the token in this header instead of the query string
+	TokenHeader string
+
+	// Connect with https, verifying against CAFile and sending CertFile/KeyFile
+	TLS                bool
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+
+	// Timeout of each request to the control server
+	Timeout time.Duration
+
+	// Workers and max threads configured in config/puma.rb, 0 if unknown
+	ConfiguredWorkers int
+	MaxThreads        int
+
+	// Poll /stats this many times per run, SampleInterval apart, for min/avg/max/p95
+	Samples        int
+	SampleInterval time.Duration
+
+	// State file of the sampler subcommand to read aggregates from
+	SamplerState string
+
+	// Per-worker series keyed by index (default), pid or index-phase, for at most MaxWorkerSeries workers
+	WorkerKey       string
+	MaxWorkerSeries int
 }
 
 func merge(m1, m2 map[string]float64) map[string]float64 {
@@ -29,50 +63,137 @@ func merge(m1, m2 map[string]float64) map[string]float64 {
 	return (ans)
 }
 
+func mergeGraphs(g1, g2 map[string]mp.Graphs) map[string]mp.Graphs {
+	ans := make(map[string]mp.Graphs)
+
+	for k, v := range g1 {
+		ans[k] = v
+	}
+	for k, v := range g2 {
+		ans[k] = v
+	}
+	return ans
+}
+
 // FetchMetrics interface for mackerelplugin
 func (p PumaPlugin) FetchMetrics() (map[string]float64, error) {
+	ret, _, err := p.fetchMetricsVersions()
+	return ret, err
+}
+
+// Metrics with the versions of /stats keyed by "", for outputs carrying them as strings
+func (p PumaPlugin) fetchMetricsVersions() (map[string]float64, map[string]*Versions, error) {
 	ret := make(map[string]float64)
 
-	stats, err := p.getStatsAPI()
+	// Samples reuse the connection of the first request.
+	// A token or certificate that cannot be used is a configuration error, not Puma down.
+	c, err := p.newClient()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	ret = p.fetchStatsMetrics(stats)
-
-	if p.WithGC == false {
-		return ret, nil
+	start := time.Now()
+	stats, err := c.Stats(context.Background())
+	if err != nil {
+		if !controlDown(err) {
+			return nil, nil, err
+		}
+		// Report the control server down rather than failing the run
+		warn(err)
+		return fetchControlMetrics(false, 0), nil, nil
 	}
 
-	gcStats, err := p.getGCStatsAPI()
-	if err != nil {
-		return nil, err
+	// Follow the mode the server is in rather than -single
+	p = p.detectMode(stats)
+
+	ret = merge(fetchControlMetrics(true, time.Since(start)), p.fetchStatsMetrics(stats))
+	ret = merge(ret, fetchVersionMetrics(stats))
+	ret = merge(ret, p.fetchUptimeMetrics(stats, time.Now()))
+	ret = merge(ret, p.fetchMetaMetrics(stats))
+
+	if p.Samples > 1 {
+		ret = merge(ret, fetchSampleMetrics(p.sampleStats(c, stats)))
 	}
 
-	gcStatsMetrics, _ := p.fetchGCStatsMetrics(gcStats)
+	if p.SamplerState != "" {
+		// Without a running sampler the instantaneous values are still posted
+		samplerMetrics, err := p.fetchSamplerMetrics(time.Now())
+		if err != nil {
+			warn(err)
+		}
+		ret = merge(ret, samplerMetrics)
+	}
 
-	ret = merge(ret, gcStatsMetrics)
+	gcStatsOK := false
+	if p.WithGC == true {
+		gcStats, err := p.getGCStatsAPI()
+		if err != nil {
+			// /gc-stats is missing before Puma 3.10, keep the /stats metrics
+			warn(err)
+		} else {
+			gcStatsMetrics, _ := p.fetchGCStatsMetrics(gcStats)
+			ret = merge(ret, gcStatsMetrics)
+			gcStatsOK = true
+		}
+	}
 
-	return ret, nil
+	var versions map[string]*Versions
+	if stats.Versions != nil {
+		versions = map[string]*Versions{"": stats.Versions}
+	}
 
+	// Only the metrics of the graphs GraphDefinition gives for this server
+	return probedMetrics(p.probedGraphDefinition(stats, gcStatsOK), ret), versions, nil
 }
 
-// GraphDefinition interface for mackerelplugin
+// GraphDefinition interface for mackerelplugin, sized to what the server reports
 func (p PumaPlugin) GraphDefinition() map[string]mp.Graphs {
-	graphdef := graphdefStats
+	c, err := p.newClient()
+	if err != nil {
+		warn(err)
+		return p.staticGraphDefinition()
+	}
+
+	stats, err := c.Stats(context.Background())
+	if err != nil {
+		// Every graph this plugin may post, as the server cannot tell
+		warn(err)
+		return p.staticGraphDefinition()
+	}
+
+	gcStats := false
+	if p.WithGC == true {
+		_, err := c.GCStats(context.Background())
+		gcStats = err == nil
+	}
+
+	return p.probedGraphDefinition(stats, gcStats)
+}
+
+// Graphs of every metric in single or cluster mode as set in p
+func (p PumaPlugin) staticGraphDefinition() map[string]mp.Graphs {
+	graphdef := mergeGraphs(graphdefControl, mergeGraphs(graphdefStats, graphdefWorkerAge))
 
 	if p.Single == true {
-		graphdef = graphdefStatsSingle
+		graphdef = mergeGraphs(graphdefControl, graphdefStatsSingle)
+	}
+
+	graphdef = mergeGraphs(graphdef, graphdefVersion)
+	graphdef = mergeGraphs(graphdef, graphdefUptime)
+
+	if p.Samples > 1 {
+		graphdef = mergeGraphs(graphdef, graphdefSamples)
+	}
+
+	if p.SamplerState != "" {
+		graphdef = mergeGraphs(graphdef, graphdefSampler)
 	}
 
 	if p.WithGC == false {
 		return graphdef
 	}
 
-	for k, v := range graphdefGC {
-		graphdef[k] = v
-	}
-	return graphdef
+	return mergeGraphs(graphdef, graphdefGC)
 }
 
 // MetricKeyPrefix interface for PluginWithPrefix
@@ -83,30 +204,133 @@ func (p PumaPlugin) MetricKeyPrefix() string {
 	return p.Prefix
 }
 
+// Register the flags used to reach the control server
+func (p *PumaPlugin) connectionFlags(fs *flag.FlagSet) {
+	fs.StringVar(&p.Host, "host", "127.0.0.1", "The bind url to use for the control server")
+	fs.StringVar(&p.Port, "port", "9293", "The bind port to use for the control server")
+	fs.StringVar(&p.Sock, "sock", "", "The bind socket to use for the control server")
+	fs.StringVar(&p.Token, "token", "", "The token to use as authentication for the control server")
+	fs.StringVar(&p.TokenFile, "token-file", "", "Read the token from this file (default: $"+tokenEnv+" when -token is not given)")
+	fs.StringVar(&p.TokenHeader, "token-header", "", "Send the token in this HTTP header instead of the query string (Authorization sends \"Bearer <token>\")")
+	fs.BoolVar(&p.TLS, "tls", false, "Connect to the control server with https (control app bound on ssl://)")
+	fs.StringVar(&p.CAFile, "ca-file", "", "CA bundle to verify the control server certificate")
+	fs.StringVar(&p.CertFile, "cert-file", "", "Client certificate for the control server")
+	fs.StringVar(&p.KeyFile, "key-file", "", "Client certificate key for the control server")
+	fs.BoolVar(&p.InsecureSkipVerify, "insecure-skip-verify", false, "Do not verify the control server certificate")
+	fs.DurationVar(&p.Timeout, "timeout", 10*time.Second, "Timeout of each request to the control server")
+}
+
+// Subcommands run instead of the plugin
+func subcommand(name string) func(args []string) error {
+	if isControlCommand(name) {
+		return func(args []string) error { return doControl(name, args) }
+	}
+	switch name {
+	case "watch-restart":
+		return doWatchRestart
+	case "sampler":
+		return doSampler
+	case "metadata":
+		return doMetadata
+	}
+	return nil
+}
+
 // Do the plugin
 func Do() {
+	if len(os.Args) > 1 {
+		if cmd := subcommand(os.Args[1]); cmd != nil {
+			if err := cmd(os.Args[2:]); err != nil {
+				exitWithError(err)
+			}
+			return
+		}
+	}
+
+	var puma PumaPlugin
+	puma.connectionFlags(flag.CommandLine)
+
 	var (
 		optPrefix   = flag.String("metric-key-prefix", "puma", "Metric key prefix")
-		optHost     = flag.String("host", "127.0.0.1", "The bind url to use for the control server")
-		optPort     = flag.String("port", "9293", "The bind port to use for the control server")
-		optSock     = flag.String("sock", "", "The bind socket to use for the control server")
-		optToken    = flag.String("token", "", "The token to use as authentication for the control server")
-		optSingle   = flag.Bool("single", false, "Puma in single mode")
+		optSingle   = flag.Bool("single", false, "Puma in single mode, when /stats cannot tell")
 		optWithGC   = flag.Bool("with-gc", false, "Output include GC stats for Puma 3.10.0~")
 		optTempfile = flag.String("tempfile", "", "Temp file name")
+		optDiscover = flag.Bool("discover", false, "Monitor every Puma master found in procfs, named by app tag")
+		optProcfs   = flag.String("procfs", "/proc", "procfs root used with -discover")
+		optConfig   = flag.String("puma-config", "", "config/puma.rb to read the control app, workers and threads from")
+		optOutput   = flag.String("output", "mackerel", "Where to send the metrics: mackerel (stdout for mackerel-agent), statsd, graphite, influx or otlp")
+		optStatsd   = flag.String("statsd-addr", "127.0.0.1:8125", "StatsD server with -output=statsd")
+		optTags     = flag.Bool("statsd-tags", false, "Send instance and worker as DogStatsD tags instead of in the metric name")
+		optGraphite = flag.String("graphite-addr", "127.0.0.1:2003", "Graphite plaintext server with -output=graphite")
+		optOTLP     = flag.String("otlp-endpoint", "http://localhost:4318/v1/metrics", "OTLP/HTTP collector endpoint with -output=otlp")
+		optHeaders  = flag.String("otlp-headers", "", "Headers sent with -output=otlp, as name=value pairs separated by commas")
+		optInflux   = flag.String("influx-url", "", "Post -output=influx to this write endpoint instead of printing it, e.g. http://localhost:8086/write?db=puma")
 	)
+	flag.IntVar(&puma.Samples, "samples", 1, "Poll /stats this many times per run for min/avg/max/p95 of backlog, running and pool_capacity")
+	flag.DurationVar(&puma.SampleInterval, "sample-interval", time.Second, "Interval between samples with -samples")
+	flag.StringVar(&puma.WorkerKey, "worker-key", "index", "Key per-worker series by index (worker0), pid (pid601) or index-phase (worker0_phase3, retired at each phased restart)")
+	flag.IntVar(&puma.MaxWorkerSeries, "max-worker-series", 0, "Post per-worker series for at most this many workers by index, 0 for all")
+	flag.StringVar(&puma.SamplerState, "sampler-state", "", "Also post the aggregates written by the sampler subcommand to this file")
 	flag.Parse()
 
-	var puma PumaPlugin
 	puma.Prefix = *optPrefix
-	puma.Host = *optHost
-	puma.Port = *optPort
-	puma.Sock = *optSock
-	puma.Token = *optToken
 	puma.Single = *optSingle
 	puma.WithGC = *optWithGC
 
-	helper := mp.NewMackerelPlugin(puma)
-	helper.Tempfile = *optTempfile
-	helper.Run()
+	if err := puma.validateSamples(); err != nil {
+		exitWithError(err)
+	}
+	if err := puma.validateWorkerKey(); err != nil {
+		exitWithError(err)
+	}
+
+	if *optConfig != "" {
+		setFlags := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+
+		config, err := readPumaConfig(*optConfig)
+		if err == nil {
+			err = puma.applyPumaConfig(config, setFlags)
+		}
+		if err != nil {
+			exitWithError(err)
+		}
+	}
+
+	var plugin mp.PluginWithPrefix = diagnosingPlugin{puma}
+	if *optDiscover {
+		if puma.SamplerState != "" {
+			exitWithError(errors.New("-sampler-state cannot be used with -discover"))
+		}
+		plugin = puma.discoverPlugin(*optProcfs)
+	}
+
+	switch *optOutput {
+	case "mackerel":
+		// Only the graph definitions posted to Mackerel need a probe of the server
+		if os.Getenv("MACKEREL_AGENT_PLUGIN_META") == "" {
+			plugin = valuesPlugin{plugin}
+		}
+		helper := mp.NewMackerelPlugin(plugin)
+		helper.Tempfile = *optTempfile
+		helper.Run()
+	case "statsd":
+		if err := pushStatsd(plugin, *optStatsd, *optTags, *optTempfile); err != nil {
+			exitWithError(err)
+		}
+	case "graphite":
+		if err := pushGraphite(plugin, *optGraphite, puma.Timeout); err != nil {
+			exitWithError(err)
+		}
+	case "influx":
+		if err := pushInflux(plugin, *optInflux, puma.Timeout); err != nil {
+			exitWithError(err)
+		}
+	case "otlp":
+		if err := pushOTLP(plugin, *optOTLP, *optHeaders, puma.Timeout); err != nil {
+			exitWithError(err)
+		}
+	default:
+		exitWithError(errors.New("unknown -output " + *optOutput))
+	}
 }
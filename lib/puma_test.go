@@ -2,15 +2,20 @@ package mppuma
 
 import (
 	"encoding/json"
+	"net/http"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/rmanzoku/mackerel-plugin-puma/lib/pumatest"
 )
 
 func TestGraphDefinition(t *testing.T) {
-	desired := 5
+	desired := 14
 
 	var puma PumaPlugin
 
-	graphdef := puma.GraphDefinition()
+	graphdef := puma.staticGraphDefinition()
 
 	if len(graphdef) != desired {
 		t.Errorf("GraphDefinition: %d should be %d", len(graphdef), desired)
@@ -18,12 +23,12 @@ func TestGraphDefinition(t *testing.T) {
 }
 
 func TestGraphDefinitionWithGC(t *testing.T) {
-	desired := 9
+	desired := 18
 
 	var puma PumaPlugin
 	puma.WithGC = true
 
-	graphdef := puma.GraphDefinition()
+	graphdef := puma.staticGraphDefinition()
 
 	if len(graphdef) != desired {
 		t.Errorf("GraphDefinitionWithGC: %d should be %d", len(graphdef), desired)
@@ -66,16 +71,24 @@ func TestGraphDefinitionCluster(t *testing.T) {
 	}`
 
 	desired := map[string]float64{
-		"workers":                       float64(2),
-		"spawn_workers":                 float64(2),
-		"removed_workers":               float64(0),
-		"phase":                         float64(0),
-		"backlog.worker0.backlog":       float64(1),
-		"running.worker0.running":       float64(5),
-		"running.worker0.pool_capacity": float64(4),
-		"backlog.worker1.backlog":       float64(1),
-		"running.worker1.running":       float64(5),
-		"running.worker1.pool_capacity": float64(4),
+		"configured":                          float64(2),
+		"booted":                              float64(2),
+		"old":                                 float64(0),
+		"missing":                             float64(0),
+		"phase":                               float64(0),
+		"backlog.worker0.backlog":             float64(1),
+		"running.worker0.running":             float64(5),
+		"pool_capacity.worker0.pool_capacity": float64(4),
+		"backlog.worker1.backlog":             float64(1),
+		"running.worker1.running":             float64(5),
+		"pool_capacity.worker1.pool_capacity": float64(4),
+		"unbooted":                            float64(0),
+		"booted.worker0.booted":               float64(1),
+		"booted.worker1.booted":               float64(1),
+		"pool_exhausted":                      float64(0),
+		"backlog_nonzero":                     float64(1),
+		"workers_exhausted":                   float64(0),
+		"workers_with_backlog":                float64(2),
 	}
 
 	var p PumaPlugin
@@ -99,18 +112,174 @@ func TestGraphDefinitionCluster(t *testing.T) {
 	}
 }
 
+func TestFetchStatsMetricsUnbooted(t *testing.T) {
+
+	statJSON := `{
+	  "workers": 2,
+	  "phase": 0,
+	  "booted_workers": 1,
+	  "old_workers": 0,
+	  "worker_status": [
+	    {
+	      "pid": 1,
+	      "index": 0,
+	      "phase": 0,
+	      "booted": true,
+	      "last_status": {"backlog": 0, "running": 5, "pool_capacity": 2, "max_threads": 5}
+	    },
+	    {
+	      "pid": 2,
+	      "index": 1,
+	      "phase": 0,
+	      "booted": false,
+	      "last_status": {}
+	    }
+	  ]
+	}`
+
+	desired := map[string]float64{
+		"unbooted":              float64(1),
+		"missing":               float64(1),
+		"booted.worker0.booted": float64(1),
+		"booted.worker1.booted": float64(0),
+		"busy":                  float64(3),
+	}
+
+	var p PumaPlugin
+	var stats Stats
+	json.Unmarshal([]byte(statJSON), &stats)
+
+	if !stats.WorkerStatus[0].LastStatus.Reported || stats.WorkerStatus[1].LastStatus.Reported {
+		t.Errorf("only worker0 should have reported last_status")
+	}
+
+	ret := p.fetchStatsMetrics(&stats)
+
+	for k, v := range desired {
+		if ret[k] != v {
+			t.Errorf("%s should be %f, out %f", k, v, ret[k])
+		}
+	}
+	for _, k := range []string{"backlog.worker1.backlog", "running.worker1.running", "pool_capacity.worker1.pool_capacity", "requests.worker1.requests"} {
+		if _, ok := ret[k]; ok {
+			t.Errorf("%s should not be fetched before the worker checks in", k)
+		}
+	}
+}
+
+func TestFetchStatsMetricsSaturation(t *testing.T) {
+
+	statJSON := `{
+	  "workers": 3,
+	  "phase": 0,
+	  "booted_workers": 2,
+	  "old_workers": 0,
+	  "worker_status": [
+	    {
+	      "pid": 1,
+	      "index": 0,
+	      "booted": true,
+	      "last_status": {"backlog": 3, "running": 5, "pool_capacity": 0}
+	    },
+	    {
+	      "pid": 2,
+	      "index": 1,
+	      "booted": true,
+	      "last_status": {"backlog": 1, "running": 5, "pool_capacity": 2}
+	    },
+	    {
+	      "pid": 3,
+	      "index": 2,
+	      "booted": false,
+	      "last_status": {}
+	    }
+	  ]
+	}`
+
+	desired := map[string]float64{
+		"pool_exhausted":       float64(1),
+		"backlog_nonzero":      float64(1),
+		"workers_exhausted":    float64(1),
+		"workers_with_backlog": float64(2),
+	}
+
+	var p PumaPlugin
+	var stats Stats
+	json.Unmarshal([]byte(statJSON), &stats)
+
+	ret := p.fetchStatsMetrics(&stats)
+
+	for k, v := range desired {
+		if ret[k] != v {
+			t.Errorf("%s should be %f, out %f", k, v, ret[k])
+		}
+	}
+}
+
+func TestFetchStatsMetricsCapacity(t *testing.T) {
+
+	statJSON := `{
+	  "workers": 3,
+	  "phase": 1,
+	  "booted_workers": 2,
+	  "old_workers": 1,
+	  "worker_status": [
+	    {
+	      "pid": 1,
+	      "index": 0,
+	      "phase": 1,
+	      "booted": true,
+	      "last_status": {"backlog": 0, "running": 5, "pool_capacity": 2, "max_threads": 5}
+	    },
+	    {
+	      "pid": 2,
+	      "index": 1,
+	      "phase": 1,
+	      "booted": true,
+	      "last_status": {"backlog": 0, "running": 5, "pool_capacity": 5, "max_threads": 5}
+	    }
+	  ]
+	}`
+
+	desired := map[string]float64{
+		"configured": float64(3),
+		"booted":     float64(2),
+		"old":        float64(1),
+		"missing":    float64(1),
+		"capacity":   float64(15),
+		"busy":       float64(3),
+	}
+
+	// max_threads reported by Puma wins over config/puma.rb
+	p := PumaPlugin{MaxThreads: 16}
+	var stats Stats
+	json.Unmarshal([]byte(statJSON), &stats)
+
+	ret := p.fetchStatsMetrics(&stats)
+
+	for k, v := range desired {
+		if ret[k] != v {
+			t.Errorf("%s should be %f, out %f", k, v, ret[k])
+		}
+	}
+}
+
 func TestGraphDefinitionSingle(t *testing.T) {
 
 	statJSON := `{
 		"backlog": 1,
 		"running": 5,
-		"pool_capacity": 4
+		"pool_capacity": 4,
+		"requests_count": 42
 	}`
 
 	desired := map[string]float64{
-		"backlog":       float64(1),
-		"running":       float64(5),
-		"pool_capacity": float64(4),
+		"backlog":         float64(1),
+		"running":         float64(5),
+		"pool_capacity":   float64(4),
+		"requests":        float64(42),
+		"pool_exhausted":  float64(0),
+		"backlog_nonzero": float64(1),
 	}
 
 	var p PumaPlugin
@@ -135,3 +304,157 @@ func TestGraphDefinitionSingle(t *testing.T) {
 		}
 	}
 }
+
+// PumaPlugin for a pumatest server
+func pumatestPlugin(s *pumatest.Server, v pumatest.Version) PumaPlugin {
+	var p PumaPlugin
+	p.Host = s.Host
+	p.Port = s.Port
+	p.Sock = s.Sock
+	p.Single = v.Single
+	p.WithGC = true
+	return p
+}
+
+func TestFetchMetricsPumatest(t *testing.T) {
+	for _, v := range pumatest.Versions {
+		tcp := pumatest.NewServer(v)
+		unix, err := pumatest.NewUnixServer(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, s := range []*pumatest.Server{tcp, unix} {
+			s.SetToken("12345")
+			p := pumatestPlugin(s, v)
+			p.Token = "12345"
+
+			ret, err := p.FetchMetrics()
+			if err != nil {
+				t.Errorf("%s: FetchMetrics: %s", v.Name, err)
+				continue
+			}
+			if _, ok := ret["total"]; !ok {
+				t.Errorf("%s: gc stats should be fetched", v.Name)
+			}
+			if _, ok := ret["running"]; v.Single && !ok {
+				t.Errorf("%s: running should be fetched", v.Name)
+			}
+			if _, ok := ret["booted"]; !v.Single && !ok {
+				t.Errorf("%s: booted should be fetched", v.Name)
+			}
+		}
+
+		tcp.Close()
+		unix.Close()
+	}
+}
+
+func TestFetchMetricsPumatestErrors(t *testing.T) {
+	s := pumatest.NewServer(pumatest.Puma5Cluster)
+	defer s.Close()
+	s.SetToken("12345")
+
+	p := pumatestPlugin(s, pumatest.Puma5Cluster)
+	p.Token = "54321"
+
+	ret, err := p.FetchMetrics()
+	if err != nil {
+		t.Errorf("FetchMetrics with a wrong token should report up = 0, out %v", err)
+	}
+	if len(ret) != 1 || ret["up"] != 0 {
+		t.Errorf("FetchMetrics with a wrong token should be only up = 0, out %v", ret)
+	}
+
+	p.Token = "12345"
+	s.SetStatus("/gc-stats", http.StatusInternalServerError)
+	ret, err = p.FetchMetrics()
+	if err != nil {
+		t.Errorf("FetchMetrics with /gc-stats failing should keep the /stats metrics, out %v", err)
+	}
+	if ret["up"] != 1 || ret["booted"] == 0 {
+		t.Errorf("FetchMetrics with /gc-stats failing should be up with /stats metrics, out %v", ret)
+	}
+	if _, ok := ret["total"]; ok {
+		t.Errorf("FetchMetrics with /gc-stats failing should not have gc metrics, out %v", ret)
+	}
+
+	s.SetStatus("/gc-stats", 0)
+	s.SetLatency(50 * time.Millisecond)
+	ret, err = p.FetchMetrics()
+	if err != nil {
+		t.Errorf("FetchMetrics: %s", err)
+	}
+	if ret["up"] != 1 || ret["response_time_ms"] < 50 {
+		t.Errorf("FetchMetrics should be up with response_time_ms >= 50, out %f %f", ret["up"], ret["response_time_ms"])
+	}
+}
+
+func TestFetchMetricsTokenHeader(t *testing.T) {
+	s := pumatest.NewServer(pumatest.Puma5Cluster)
+	defer s.Close()
+	s.SetToken("12345")
+
+	cases := []struct {
+		server string
+		client string
+		up     float64
+	}{
+		{"Authorization", "Authorization", 1},
+		{"X-Puma-Token", "X-Puma-Token", 1},
+		{"X-Puma-Token", "", 0},
+		{"", "X-Puma-Token", 0},
+	}
+
+	for _, c := range cases {
+		s.SetTokenHeader(c.server)
+		p := pumatestPlugin(s, pumatest.Puma5Cluster)
+		p.Token = "12345"
+		p.TokenHeader = c.client
+
+		ret, err := p.FetchMetrics()
+		if err != nil {
+			t.Errorf("FetchMetrics with -token-header %q: %s", c.client, err)
+		}
+		if ret["up"] != c.up {
+			t.Errorf("FetchMetrics with -token-header %q against header %q should be up = %f, out %f", c.client, c.server, c.up, ret["up"])
+		}
+	}
+}
+
+func TestFetchStatsMetricsConfiguredWorkers(t *testing.T) {
+	stats := Stats{Workers: 2, BootedWorkers: 2}
+
+	var p PumaPlugin
+	p.ConfiguredWorkers = 4
+	p.MaxThreads = 5
+	ret := p.fetchStatsMetrics(&stats)
+
+	if ret["configured"] != 4 || ret["missing"] != 2 {
+		t.Errorf("fetchStatsMetrics with 4 workers in config/puma.rb: configured and missing should be 4 and 2, out %f %f", ret["configured"], ret["missing"])
+	}
+	// The running workers serve, not the ones of config/puma.rb
+	if ret["capacity"] != 10 {
+		t.Errorf("fetchStatsMetrics with 2 running workers of 5 threads: capacity should be 10, out %f", ret["capacity"])
+	}
+}
+
+func TestFetchMetricsConfigErrors(t *testing.T) {
+	s := pumatest.NewServer(pumatest.Puma5Cluster)
+	defer s.Close()
+
+	p := pumatestPlugin(s, pumatest.Puma5Cluster)
+	p.TokenFile = filepath.Join(t.TempDir(), "missing")
+
+	// Not Puma down, so no up = 0 but an error for the exit code
+	if ret, err := p.FetchMetrics(); err == nil {
+		t.Errorf("FetchMetrics with an unreadable -token-file should fail, out %v", ret)
+	}
+
+	p.TokenFile = ""
+	p.TLS = true
+	p.CAFile = filepath.Join(t.TempDir(), "missing.pem")
+	if ret, err := p.FetchMetrics(); err == nil {
+		t.Errorf("FetchMetrics with an unreadable -ca-file should fail, out %v", ret)
+	}
+}
@@ -0,0 +1,208 @@
+package mppuma
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Settings read from config/puma.rb, -1 for counts not found
+type pumaConfig struct {
+	ControlURL   string
+	ControlToken string
+	Workers      int
+	MaxThreads   int
+	StatePath    string
+	Binds        []string
+}
+
+var (
+	configCall   = regexp.MustCompile(`^(activate_control_app|workers|threads|state_path|bind)\b\s*(.*)$`)
+	configAssign = regexp.MustCompile(`^([a-z_][a-zA-Z0-9_]*)\s*=\s*(.+)$`)
+	configString = regexp.MustCompile(`^\s*['"]([^'"]*)['"]`)
+	configToken  = regexp.MustCompile(`(?:auth_token:|:auth_token\s*=>)\s*['"]([^'"]*)['"]`)
+	// ENV.fetch("NAME") { default } or ENV.fetch("NAME", default) or ENV["NAME"] || default
+	configEnv = regexp.MustCompile(`ENV(?:\.fetch\(\s*|\[\s*)['"]([A-Za-z0-9_]+)['"]\s*(?:,\s*([^)]+))?[)\]]\s*(?:\{\s*([^}]+?)\s*\}|\|\|\s*(.+))?`)
+)
+
+// Read the DSL calls of config/puma.rb this plugin needs, ignoring the rest of the Ruby
+func readPumaConfig(path string) (*pumaConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	config := &pumaConfig{Workers: -1, MaxThreads: -1}
+	vars := make(map[string]string)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+
+		m := configCall.FindStringSubmatch(line)
+		if m == nil {
+			if m := configAssign.FindStringSubmatch(line); m != nil {
+				vars[m[1]] = m[2]
+			}
+			continue
+		}
+		args := strings.TrimSpace(m[2])
+		if strings.HasPrefix(args, "(") && strings.HasSuffix(args, ")") {
+			args = args[1 : len(args)-1]
+		}
+
+		switch m[1] {
+		case "activate_control_app":
+			// Without a url Puma picks a random socket ("auto") which cannot be found
+			if s := configString.FindStringSubmatch(args); s != nil && s[1] != "auto" {
+				config.ControlURL = s[1]
+			}
+			if s := configToken.FindStringSubmatch(args); s != nil {
+				config.ControlToken = s[1]
+			}
+		case "workers":
+			if n, ok := evalInt(args, vars); ok {
+				config.Workers = n
+			}
+		case "threads":
+			// threads min, max
+			threads := splitArgs(args)
+			if len(threads) == 2 {
+				if n, ok := evalInt(threads[1], vars); ok {
+					config.MaxThreads = n
+				}
+			}
+		case "state_path":
+			if s := configString.FindStringSubmatch(args); s != nil {
+				config.StatePath = s[1]
+			}
+		case "bind":
+			if s := configString.FindStringSubmatch(args); s != nil {
+				config.Binds = append(config.Binds, s[1])
+			}
+		}
+	}
+	return config, scanner.Err()
+}
+
+// Remove a trailing # comment outside of string literals
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// Split call arguments on commas outside of parentheses and braces
+func splitArgs(args string) []string {
+	var ret []string
+	depth, start := 0, 0
+	for i, r := range args {
+		switch r {
+		case '(', '{', '[':
+			depth++
+		case ')', '}', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				ret = append(ret, strings.TrimSpace(args[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(ret, strings.TrimSpace(args[start:]))
+}
+
+// Integer value of a literal, a local variable or an ENV lookup with its default
+func evalInt(expr string, vars map[string]string) (int, bool) {
+	return evalIntDepth(expr, vars, 0)
+}
+
+func evalIntDepth(expr string, vars map[string]string, depth int) (int, bool) {
+	if depth > 8 {
+		return 0, false
+	}
+	expr = strings.TrimSpace(expr)
+
+	// Integer(...) and .to_i conversions
+	expr = strings.TrimSuffix(expr, ".to_i")
+	if strings.HasPrefix(expr, "Integer(") && strings.HasSuffix(expr, ")") {
+		expr = strings.TrimSpace(expr[len("Integer(") : len(expr)-1])
+	}
+
+	if n, err := strconv.Atoi(expr); err == nil {
+		return n, true
+	}
+	if v, ok := vars[expr]; ok {
+		return evalIntDepth(v, vars, depth+1)
+	}
+
+	m := configEnv.FindStringSubmatch(expr)
+	if m == nil {
+		return 0, false
+	}
+	if v, ok := os.LookupEnv(m[1]); ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			return n, true
+		}
+	}
+	for _, def := range m[2:] {
+		if def != "" {
+			return evalIntDepth(strings.Trim(def, `'"`), vars, depth+1)
+		}
+	}
+	return 0, false
+}
+
+// Whether config can be the one a master listening on binds was started with.
+// Binds built with interpolation cannot be compared and are taken to match.
+func (config *pumaConfig) matchBinds(binds []string) bool {
+	if len(config.Binds) == 0 || len(binds) == 0 {
+		return true
+	}
+	listening := make(map[string]bool)
+	for _, b := range binds {
+		listening[b] = true
+	}
+	for _, b := range config.Binds {
+		if listening[b] || strings.Contains(b, "#{") {
+			return true
+		}
+	}
+	return false
+}
+
+// Point p at the control app of config, and take its worker and thread counts
+func (p *PumaPlugin) applyPumaConfig(config *pumaConfig, setFlags map[string]bool) error {
+	if config.ControlURL != "" && !setFlags["host"] && !setFlags["port"] && !setFlags["sock"] {
+		if err := p.setControlURL(config.ControlURL); err != nil {
+			return err
+		}
+	}
+	if config.ControlToken != "" && !setFlags["token"] && !setFlags["token-file"] {
+		p.Token = config.ControlToken
+	}
+	if config.Workers >= 0 {
+		p.ConfiguredWorkers = config.Workers
+		if !setFlags["single"] {
+			p.Single = config.Workers == 0
+		}
+	}
+	if config.MaxThreads > 0 {
+		p.MaxThreads = config.MaxThreads
+	}
+	return nil
+}
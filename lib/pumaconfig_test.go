@@ -0,0 +1,130 @@
+package mppuma
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writePumaConfig(t *testing.T, body string) string {
+	path := filepath.Join(t.TempDir(), "puma.rb")
+	if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadPumaConfigRails(t *testing.T) {
+	path := writePumaConfig(t, `# Puma can serve each request in a thread from an internal thread pool.
+max_threads_count = ENV.fetch("RAILS_MAX_THREADS") { 5 }
+min_threads_count = ENV.fetch("RAILS_MIN_THREADS") { max_threads_count }
+threads min_threads_count, max_threads_count
+
+port ENV.fetch("PORT") { 3000 }
+environment ENV.fetch("RAILS_ENV") { "development" }
+pidfile ENV.fetch("PIDFILE") { "tmp/pids/server.pid" }
+
+workers ENV.fetch("WEB_CONCURRENCY") { 2 }
+preload_app!
+
+activate_control_app 'unix:///var/run/myapp/pumactl.sock', { auth_token: 's3cr#t' } # control app
+state_path "tmp/pids/puma.state"
+bind 'tcp://0.0.0.0:3000'
+bind "unix:///var/run/myapp/puma.sock"
+
+plugin :tmp_restart
+`)
+	t.Setenv("WEB_CONCURRENCY", "4")
+
+	config, err := readPumaConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desired := pumaConfig{
+		ControlURL:   "unix:///var/run/myapp/pumactl.sock",
+		ControlToken: "s3cr#t",
+		Workers:      4,
+		MaxThreads:   5,
+		StatePath:    "tmp/pids/puma.state",
+	}
+	if config.ControlURL != desired.ControlURL || config.ControlToken != desired.ControlToken ||
+		config.Workers != desired.Workers ||
+		config.MaxThreads != desired.MaxThreads || config.StatePath != desired.StatePath {
+		t.Errorf("readPumaConfig: should be %+v, out %+v", desired, config)
+	}
+	if len(config.Binds) != 2 || config.Binds[1] != "unix:///var/run/myapp/puma.sock" {
+		t.Errorf("readPumaConfig: binds out %v", config.Binds)
+	}
+}
+
+func TestPumaConfigMatchBinds(t *testing.T) {
+	cases := []struct {
+		config  []string
+		title   []string
+		desired bool
+	}{
+		{[]string{"tcp://0.0.0.0:3000", "unix:///tmp/puma.sock"}, []string{"unix:///tmp/puma.sock"}, true},
+		{[]string{"tcp://0.0.0.0:3000"}, []string{"tcp://0.0.0.0:4000"}, false},
+		{[]string{"tcp://0.0.0.0:#{ENV['PORT']}"}, []string{"tcp://0.0.0.0:4000"}, true},
+		{nil, []string{"tcp://0.0.0.0:4000"}, true},
+	}
+
+	for _, c := range cases {
+		config := pumaConfig{Binds: c.config}
+		if ret := config.matchBinds(c.title); ret != c.desired {
+			t.Errorf("matchBinds(%v) of %v: should be %v, out %v", c.title, c.config, c.desired, ret)
+		}
+	}
+}
+
+func TestReadPumaConfigVariants(t *testing.T) {
+	cases := []struct {
+		body    string
+		workers int
+		max     int
+		url     string
+		token   string
+	}{
+		{"workers 3\nthreads 1, 8\n", 3, 8, "", ""},
+		{"workers(Integer(ENV['WEB_CONCURRENCY'] || 6))\nthreads(0, 16)\n", 6, 16, "", ""},
+		{"workers ENV.fetch('WEB_CONCURRENCY', 2).to_i\n", 2, -1, "", ""},
+		{"activate_control_app('tcp://127.0.0.1:9293', :auth_token => 'abc')\n", -1, -1, "tcp://127.0.0.1:9293", "abc"},
+		{"activate_control_app\n", -1, -1, "", ""},
+		{"workers_count = 4 # not a call\n", -1, -1, "", ""},
+	}
+
+	for _, c := range cases {
+		config, err := readPumaConfig(writePumaConfig(t, c.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Workers != c.workers || config.MaxThreads != c.max || config.ControlURL != c.url || config.ControlToken != c.token {
+			t.Errorf("readPumaConfig(%q): out %+v", c.body, config)
+		}
+	}
+}
+
+func TestApplyPumaConfig(t *testing.T) {
+	config := &pumaConfig{ControlURL: "tcp://10.0.0.1:9294", ControlToken: "abc", Workers: 0, MaxThreads: 5}
+
+	var p PumaPlugin
+	p.Host = "127.0.0.1"
+	p.Port = "9293"
+	if err := p.applyPumaConfig(config, map[string]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if p.Host != "10.0.0.1" || p.Port != "9294" || p.Token != "abc" || !p.Single || p.MaxThreads != 5 {
+		t.Errorf("applyPumaConfig: out %+v", p)
+	}
+
+	// Flags given on the command line win
+	p = PumaPlugin{Host: "127.0.0.1", Port: "9293", Token: "xyz"}
+	config.Workers = 2
+	if err := p.applyPumaConfig(config, map[string]bool{"port": true, "token": true}); err != nil {
+		t.Fatal(err)
+	}
+	if p.Port != "9293" || p.Token != "xyz" || p.Single || p.ConfiguredWorkers != 2 {
+		t.Errorf("applyPumaConfig with flags: out %+v", p)
+	}
+}
@@ -0,0 +1,192 @@
+// Package pumatest provides a fake Puma control app for end to end tests.
+package pumatest
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Control commands answered with {"status": "ok"}
+var commands = map[string]bool{
+	"/restart":                 true,
+	"/phased-restart":          true,
+	"/reload-worker-directory": true,
+	"/gc":                      true,
+	"/halt":                    true,
+	"/stop":                    true,
+}
+
+// Server is a fake Puma control app listening on TCP or a unix socket
+type Server struct {
+	// Host and Port of a TCP server
+	Host string
+	Port string
+	// Sock is the path of a unix socket server
+	Sock string
+
+	server *httptest.Server
+	dir    string
+
+	mu       sync.Mutex
+	version  Version
+	token    string
+	header   string
+	latency  time.Duration
+	statuses map[string]int
+	requests map[string]int
+}
+
+// NewServer starts a fake control app on a local TCP port
+func NewServer(v Version) *Server {
+	s := newServer(v)
+	s.server = httptest.NewServer(s)
+	s.Host, s.Port, _ = net.SplitHostPort(s.server.Listener.Addr().String())
+	return s
+}
+
+// NewUnixServer starts a fake control app on a unix socket in a temporary directory
+func NewUnixServer(v Version) (*Server, error) {
+	dir, err := os.MkdirTemp("", "pumatest")
+	if err != nil {
+		return nil, err
+	}
+
+	sock := filepath.Join(dir, "pumactl.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	s := newServer(v)
+	s.dir = dir
+	s.Sock = sock
+	s.server = httptest.NewUnstartedServer(s)
+	s.server.Listener.Close()
+	s.server.Listener = l
+	s.server.Start()
+	return s, nil
+}
+
+func newServer(v Version) *Server {
+	return &Server{
+		version:  v,
+		statuses: make(map[string]int),
+		requests: make(map[string]int),
+	}
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.server.Close()
+	if s.dir != "" {
+		os.RemoveAll(s.dir)
+	}
+}
+
+// SetVersion replaces the payloads served
+func (s *Server) SetVersion(v Version) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version = v
+}
+
+// SetToken makes the server require ?token=, as control_auth_token does
+func (s *Server) SetToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = token
+}
+
+// SetTokenHeader makes the server take the token from header instead of ?token=,
+// as "Bearer <token>" for Authorization, like a proxy in front of the control app
+func (s *Server) SetTokenHeader(header string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.header = header
+}
+
+// SetLatency delays every response
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// SetStatus answers path (e.g. "/stats") with an empty response of status code, 0 to reset
+func (s *Server) SetStatus(path string, code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if code == 0 {
+		delete(s.statuses, path)
+		return
+	}
+	s.statuses[path] = code
+}
+
+// Requests returns how many requests path has received
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// ServeHTTP answers like Puma::App::Status
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests[r.URL.Path]++
+	version, token, header, latency := s.version, s.token, s.header, s.latency
+	status, injected := s.statuses[r.URL.Path]
+	s.mu.Unlock()
+
+	time.Sleep(latency)
+
+	if injected {
+		w.WriteHeader(status)
+		return
+	}
+
+	given := r.URL.Query().Get("token")
+	if header != "" {
+		given = r.Header.Get(header)
+		if strings.EqualFold(header, "Authorization") {
+			given = strings.TrimPrefix(given, "Bearer ")
+		}
+	}
+	if token != "" && given != token {
+		writeJSON(w, http.StatusForbidden, `{ "error": "Invalid auth token" }`)
+		return
+	}
+
+	var body string
+	switch r.URL.Path {
+	case "/stats":
+		body = version.Stats
+	case "/gc-stats":
+		body = version.GCStats
+	case "/thread-backtraces":
+		body = version.ThreadBacktraces
+	default:
+		if commands[r.URL.Path] {
+			body = `{ "status": "ok" }`
+		}
+	}
+
+	if body == "" {
+		writeJSON(w, http.StatusNotFound, `{ "error": "Unsupported action" }`)
+		return
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+func writeJSON(w http.ResponseWriter, code int, body string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write([]byte(body))
+}
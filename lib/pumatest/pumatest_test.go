@@ -0,0 +1,66 @@
+package pumatest
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestVersionsAreJSON(t *testing.T) {
+	for _, v := range Versions {
+		for name, body := range map[string]string{"stats": v.Stats, "gc-stats": v.GCStats, "thread-backtraces": v.ThreadBacktraces} {
+			if body == "" {
+				continue
+			}
+			if !json.Valid([]byte(body)) {
+				t.Errorf("%s %s is not valid JSON", v.Name, name)
+			}
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	s := NewServer(Puma3Cluster)
+	defer s.Close()
+	s.SetToken("12345")
+
+	base := "http://" + s.Host + ":" + s.Port
+
+	cases := []struct {
+		path    string
+		desired int
+	}{
+		{"/stats?token=12345", http.StatusOK},
+		{"/stats?token=54321", http.StatusForbidden},
+		{"/gc-stats?token=12345", http.StatusOK},
+		{"/thread-backtraces?token=12345", http.StatusNotFound},
+		{"/phased-restart?token=12345", http.StatusOK},
+		{"/unknown?token=12345", http.StatusNotFound},
+	}
+
+	for _, c := range cases {
+		resp, err := http.Get(base + c.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != c.desired {
+			t.Errorf("%s should be %d, out %d", c.path, c.desired, resp.StatusCode)
+		}
+	}
+
+	if n := s.Requests("/stats"); n != 2 {
+		t.Errorf("Requests(/stats) should be 2, out %d", n)
+	}
+
+	s.SetStatus("/stats", http.StatusInternalServerError)
+	resp, err := http.Get(base + "/stats?token=12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("injected status should be 500, out %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,257 @@
+package pumatest
+
+// Version is a set of control app payloads as served by a Puma version
+type Version struct {
+	Name string
+	// Single is true for a Puma without workers
+	Single           bool
+	Stats            string
+	GCStats          string
+	ThreadBacktraces string
+}
+
+const threadBacktraces = `[
+  {
+    "name": "Thread: TID-1 puma threadpool 001",
+    "backtrace": [
+      "/usr/local/bundle/gems/puma/lib/puma/thread_pool.rb:106:in 'sleep'",
+      "/usr/local/bundle/gems/puma/lib/puma/thread_pool.rb:106:in 'block in spawn_thread'"
+    ]
+  }
+]`
+
+// Puma 3.x on Ruby 2.4
+var (
+	Puma3Single = Version{
+		Name:   "puma-3-single",
+		Single: true,
+		Stats: `{
+  "backlog": 0,
+  "running": 5,
+  "pool_capacity": 5
+}`,
+		GCStats:          gcStatsRuby24,
+		ThreadBacktraces: "",
+	}
+
+	Puma3Cluster = Version{
+		Name: "puma-3-cluster",
+		Stats: `{
+  "workers": 2,
+  "phase": 0,
+  "booted_workers": 2,
+  "old_workers": 0,
+  "worker_status": [
+    {
+      "pid": 101,
+      "index": 0,
+      "phase": 0,
+      "booted": true,
+      "last_checkin": "2018-04-17T01:24:16Z",
+      "last_status": { "backlog": 0, "running": 5, "pool_capacity": 5 }
+    },
+    {
+      "pid": 102,
+      "index": 1,
+      "phase": 0,
+      "booted": true,
+      "last_checkin": "2018-04-17T01:24:16Z",
+      "last_status": { "backlog": 1, "running": 5, "pool_capacity": 0 }
+    }
+  ]
+}`,
+		GCStats:          gcStatsRuby24,
+		ThreadBacktraces: "",
+	}
+)
+
+// Puma 4.x on Ruby 2.6, adding max_threads
+var (
+	Puma4Cluster = Version{
+		Name: "puma-4-cluster",
+		Stats: `{
+  "workers": 2,
+  "phase": 1,
+  "booted_workers": 2,
+  "old_workers": 0,
+  "worker_status": [
+    {
+      "pid": 201,
+      "index": 0,
+      "phase": 1,
+      "booted": true,
+      "last_checkin": "2020-03-02T10:11:12Z",
+      "last_status": { "backlog": 0, "running": 5, "pool_capacity": 3, "max_threads": 5 }
+    },
+    {
+      "pid": 202,
+      "index": 1,
+      "phase": 1,
+      "booted": true,
+      "last_checkin": "2020-03-02T10:11:12Z",
+      "last_status": { "backlog": 0, "running": 5, "pool_capacity": 5, "max_threads": 5 }
+    }
+  ]
+}`,
+		GCStats:          gcStatsRuby24,
+		ThreadBacktraces: threadBacktraces,
+	}
+)
+
+// Puma 5.x on Ruby 2.7, adding started_at and requests_count
+var (
+	Puma5Cluster = Version{
+		Name: "puma-5-cluster",
+		Stats: `{
+  "started_at": "2021-01-14T07:09:17Z",
+  "workers": 2,
+  "phase": 0,
+  "booted_workers": 2,
+  "old_workers": 0,
+  "worker_status": [
+    {
+      "started_at": "2021-01-14T07:09:17Z",
+      "pid": 301,
+      "index": 0,
+      "phase": 0,
+      "booted": true,
+      "last_checkin": "2021-01-14T07:09:24Z",
+      "last_status": { "backlog": 0, "running": 5, "pool_capacity": 4, "max_threads": 5, "requests_count": 12 }
+    },
+    {
+      "started_at": "2021-01-14T07:09:18Z",
+      "pid": 302,
+      "index": 1,
+      "phase": 0,
+      "booted": true,
+      "last_checkin": "2021-01-14T07:09:24Z",
+      "last_status": { "backlog": 0, "running": 5, "pool_capacity": 5, "max_threads": 5, "requests_count": 7 }
+    }
+  ]
+}`,
+		GCStats:          gcStatsRuby24,
+		ThreadBacktraces: threadBacktraces,
+	}
+)
+
+// Puma 6.x on Ruby 3.2, adding versions
+var (
+	Puma6Single = Version{
+		Name:   "puma-6-single",
+		Single: true,
+		Stats: `{
+  "started_at": "2023-11-08T02:03:04Z",
+  "backlog": 0,
+  "running": 3,
+  "pool_capacity": 2,
+  "max_threads": 3,
+  "requests_count": 42,
+  "versions": {
+    "puma": "6.4.2",
+    "ruby": { "engine": "ruby", "version": "3.2.2", "patchlevel": 53 }
+  }
+}`,
+		GCStats:          gcStatsRuby32,
+		ThreadBacktraces: threadBacktraces,
+	}
+
+	Puma6Cluster = Version{
+		Name: "puma-6-cluster",
+		Stats: `{
+  "started_at": "2023-11-08T02:03:04Z",
+  "workers": 2,
+  "phase": 0,
+  "booted_workers": 2,
+  "old_workers": 0,
+  "worker_status": [
+    {
+      "started_at": "2023-11-08T02:03:05Z",
+      "pid": 601,
+      "index": 0,
+      "phase": 0,
+      "booted": true,
+      "last_checkin": "2023-11-08T02:10:00Z",
+      "last_status": { "backlog": 0, "running": 3, "pool_capacity": 3, "max_threads": 3, "requests_count": 100 }
+    },
+    {
+      "started_at": "2023-11-08T02:03:05Z",
+      "pid": 602,
+      "index": 1,
+      "phase": 0,
+      "booted": true,
+      "last_checkin": "2023-11-08T02:10:00Z",
+      "last_status": { "backlog": 2, "running": 3, "pool_capacity": 0, "max_threads": 3, "requests_count": 98 }
+    }
+  ],
+  "versions": {
+    "puma": "6.4.2",
+    "ruby": { "engine": "ruby", "version": "3.2.2", "patchlevel": 53 }
+  }
+}`,
+		GCStats:          gcStatsRuby32,
+		ThreadBacktraces: threadBacktraces,
+	}
+)
+
+// Versions lists every predefined Version
+var Versions = []Version{Puma3Single, Puma3Cluster, Puma4Cluster, Puma5Cluster, Puma6Single, Puma6Cluster}
+
+const gcStatsRuby24 = `{
+  "count": 8,
+  "heap_allocated_pages": 65,
+  "heap_sorted_length": 65,
+  "heap_allocatable_pages": 0,
+  "heap_available_slots": 26494,
+  "heap_live_slots": 26269,
+  "heap_free_slots": 225,
+  "heap_final_slots": 0,
+  "heap_marked_slots": 11738,
+  "heap_eden_pages": 65,
+  "heap_tomb_pages": 0,
+  "total_allocated_pages": 65,
+  "total_freed_pages": 0,
+  "total_allocated_objects": 66208,
+  "total_freed_objects": 39939,
+  "malloc_increase_bytes": 105872,
+  "malloc_increase_bytes_limit": 16777216,
+  "minor_gc_count": 7,
+  "major_gc_count": 1,
+  "remembered_wb_unprotected_objects": 165,
+  "remembered_wb_unprotected_objects_limit": 286,
+  "old_objects": 10929,
+  "old_objects_limit": 14302,
+  "oldmalloc_increase_bytes": 1351056,
+  "oldmalloc_increase_bytes_limit": 16777216
+}`
+
+const gcStatsRuby32 = `{
+  "count": 21,
+  "time": 187,
+  "heap_allocated_pages": 411,
+  "heap_sorted_length": 411,
+  "heap_allocatable_pages": 0,
+  "heap_available_slots": 412374,
+  "heap_live_slots": 388912,
+  "heap_free_slots": 23462,
+  "heap_final_slots": 0,
+  "heap_marked_slots": 301443,
+  "heap_eden_pages": 411,
+  "heap_tomb_pages": 0,
+  "total_allocated_pages": 411,
+  "total_freed_pages": 0,
+  "total_allocated_objects": 2874521,
+  "total_freed_objects": 2485609,
+  "malloc_increase_bytes": 2147816,
+  "malloc_increase_bytes_limit": 33554432,
+  "minor_gc_count": 17,
+  "major_gc_count": 4,
+  "compact_count": 0,
+  "read_barrier_faults": 0,
+  "total_moved_objects": 0,
+  "remembered_wb_unprotected_objects": 1204,
+  "remembered_wb_unprotected_objects_limit": 2408,
+  "old_objects": 298112,
+  "old_objects_limit": 596224,
+  "oldmalloc_increase_bytes": 9472640,
+  "oldmalloc_increase_bytes_limit": 21174620
+}`
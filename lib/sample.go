@@ -0,0 +1,131 @@
+package mppuma
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	mp "github.com/mackerelio/go-mackerel-plugin"
+	"github.com/rmanzoku/mackerel-plugin-puma/lib/client"
+)
+
+// Longest sampling within one run, to finish well within mackerel-agent's plugin timeout
+const maxSampleWindow = 20 * time.Second
+
+// Stats sampled for min/avg/max/p95
+var sampledStats = []string{"backlog", "running", "pool_capacity"}
+
+var graphdefSamples = map[string]mp.Graphs{
+	"backlog_samples": {
+		Label:   "Puma Backlog Samples",
+		Unit:    "float",
+		Metrics: sampleMetrics("backlog", "Backlog"),
+	},
+	"running_samples": {
+		Label:   "Puma Running Thread Samples",
+		Unit:    "float",
+		Metrics: sampleMetrics("running", "Running"),
+	},
+	"pool_capacity_samples": {
+		Label:   "Puma Pool Capacity Samples",
+		Unit:    "float",
+		Metrics: sampleMetrics("pool_capacity", "Pool Capacity"),
+	},
+}
+
+func sampleMetrics(name, label string) []mp.Metrics {
+	return []mp.Metrics{
+		{Name: name + "_min", Label: label + " min", Diff: false},
+		{Name: name + "_avg", Label: label + " avg", Diff: false},
+		{Name: name + "_max", Label: label + " max", Diff: false},
+		{Name: name + "_p95", Label: label + " p95", Diff: false},
+	}
+}
+
+// Check -samples and -sample-interval fit in maxSampleWindow
+func (p PumaPlugin) validateSamples() error {
+	if p.Samples < 1 {
+		return fmt.Errorf("-samples must be at least 1, got %d", p.Samples)
+	}
+	if window := time.Duration(p.Samples-1) * p.SampleInterval; window > maxSampleWindow {
+		return fmt.Errorf("-samples %d with -sample-interval %s takes %s, more than %s", p.Samples, p.SampleInterval, window, maxSampleWindow)
+	}
+	return nil
+}
+
+// Backlog, running and pool_capacity of one sample, summed over workers in cluster mode
+func (p PumaPlugin) sampleTotals(stats *Stats) map[string]float64 {
+	if p.Single == true {
+		return map[string]float64{
+			"backlog":        float64(stats.Backlog),
+			"running":        float64(stats.Running),
+			"pool_capacity":  float64(stats.PoolCapacity),
+			"pool_exhausted": boolMetric(stats.PoolCapacity == 0),
+		}
+	}
+
+	// pool_exhausted as in the saturation graph, any reported worker at zero capacity
+	ret := map[string]float64{"backlog": 0, "running": 0, "pool_capacity": 0, "pool_exhausted": 0}
+	for _, v := range stats.WorkerStatus {
+		ret["backlog"] += float64(v.LastStatus.Backlog)
+		ret["running"] += float64(v.LastStatus.Running)
+		ret["pool_capacity"] += float64(v.LastStatus.PoolCapacity)
+		if v.LastStatus.Reported && v.LastStatus.PoolCapacity == 0 {
+			ret["pool_exhausted"] = 1
+		}
+	}
+	return ret
+}
+
+// Poll /stats over c until p.Samples samples are taken, first being the one already fetched.
+// Failed samples are skipped and sampling stops at maxSampleWindow.
+func (p PumaPlugin) sampleStats(c *client.Client, first *Stats) []map[string]float64 {
+	samples := []map[string]float64{p.sampleTotals(first)}
+	deadline := time.Now().Add(maxSampleWindow)
+
+	for i := 1; i < p.Samples; i++ {
+		time.Sleep(p.SampleInterval)
+		if time.Now().After(deadline) {
+			break
+		}
+
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		stats, err := c.Stats(ctx)
+		cancel()
+		if err != nil {
+			warn(err)
+			continue
+		}
+		samples = append(samples, p.sampleTotals(stats))
+	}
+	return samples
+}
+
+// min/avg/max/p95 of each sampled stat
+func fetchSampleMetrics(samples []map[string]float64) map[string]float64 {
+	ret := make(map[string]float64)
+	if len(samples) == 0 {
+		return ret
+	}
+
+	for _, name := range sampledStats {
+		values := make([]float64, 0, len(samples))
+		sum := 0.0
+		for _, s := range samples {
+			values = append(values, s[name])
+			sum += s[name]
+		}
+		sort.Float64s(values)
+
+		// Nearest-rank percentile
+		p95 := int(math.Ceil(0.95*float64(len(values)))) - 1
+
+		ret[name+"_min"] = values[0]
+		ret[name+"_avg"] = sum / float64(len(values))
+		ret[name+"_max"] = values[len(values)-1]
+		ret[name+"_p95"] = values[p95]
+	}
+	return ret
+}
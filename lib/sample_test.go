@@ -0,0 +1,95 @@
+package mppuma
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rmanzoku/mackerel-plugin-puma/lib/pumatest"
+)
+
+func TestFetchSampleMetrics(t *testing.T) {
+	var samples []map[string]float64
+	for i := 1; i <= 20; i++ {
+		samples = append(samples, map[string]float64{
+			"backlog":       float64(i),
+			"running":       5,
+			"pool_capacity": float64(20 - i),
+		})
+	}
+
+	desired := map[string]float64{
+		"backlog_min":       1,
+		"backlog_avg":       10.5,
+		"backlog_max":       20,
+		"backlog_p95":       19,
+		"running_min":       5,
+		"running_avg":       5,
+		"running_max":       5,
+		"running_p95":       5,
+		"pool_capacity_min": 0,
+		"pool_capacity_avg": 9.5,
+		"pool_capacity_max": 19,
+		"pool_capacity_p95": 18,
+	}
+
+	ret := fetchSampleMetrics(samples)
+
+	if len(ret) != len(desired) {
+		t.Errorf("fetchSampleMetrics: len(ret) = %d should be len(desired) = %d", len(ret), len(desired))
+	}
+	for k, v := range desired {
+		if ret[k] != v {
+			t.Errorf("%s should be %f, out %f", k, v, ret[k])
+		}
+	}
+}
+
+func TestValidateSamples(t *testing.T) {
+	cases := []struct {
+		samples  int
+		interval time.Duration
+		valid    bool
+	}{
+		{1, time.Second, true},
+		{10, time.Second, true},
+		{21, time.Second, true},
+		{22, time.Second, false},
+		{0, time.Second, false},
+	}
+
+	for _, c := range cases {
+		p := PumaPlugin{Samples: c.samples, SampleInterval: c.interval}
+		if err := p.validateSamples(); (err == nil) != c.valid {
+			t.Errorf("-samples %d -sample-interval %s: valid should be %v, out %v", c.samples, c.interval, c.valid, err)
+		}
+	}
+}
+
+func TestFetchMetricsSamples(t *testing.T) {
+	for _, v := range []pumatest.Version{pumatest.Puma6Single, pumatest.Puma6Cluster} {
+		s := pumatest.NewServer(v)
+
+		p := pumatestPlugin(s, v)
+		p.WithGC = false
+		p.Samples = 3
+		p.SampleInterval = 10 * time.Millisecond
+
+		ret, err := p.FetchMetrics()
+		if err != nil {
+			t.Errorf("%s: FetchMetrics: %s", v.Name, err)
+		}
+		if n := s.Requests("/stats"); n != 3 {
+			t.Errorf("%s: /stats should be requested 3 times, out %d", v.Name, n)
+		}
+		for _, k := range []string{"backlog_p95", "running_avg", "pool_capacity_min"} {
+			if _, ok := ret[k]; !ok {
+				t.Errorf("%s: %s not exists", v.Name, k)
+			}
+		}
+		if _, ok := p.GraphDefinition()["backlog_samples"]; !ok {
+			t.Errorf("%s: backlog_samples graph should be defined", v.Name)
+		}
+
+		s.Close()
+	}
+}
@@ -0,0 +1,225 @@
+package mppuma
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	mp "github.com/mackerelio/go-mackerel-plugin"
+	"github.com/rmanzoku/mackerel-plugin-puma/lib/client"
+)
+
+var graphdefSampler = map[string]mp.Graphs{
+	"sampler_backlog": {
+		Label:   "Puma Backlog (sampler)",
+		Unit:    "float",
+		Metrics: sampleMetrics("sampled_backlog", "Backlog"),
+	},
+	"sampler_running": {
+		Label:   "Puma Running Thread (sampler)",
+		Unit:    "float",
+		Metrics: sampleMetrics("sampled_running", "Running"),
+	},
+	"sampler_pool_capacity": {
+		Label:   "Puma Pool Capacity (sampler)",
+		Unit:    "float",
+		Metrics: sampleMetrics("sampled_pool_capacity", "Pool Capacity"),
+	},
+	"sampler_pool_exhausted": {
+		Label: "Puma Pool Exhausted (sampler)",
+		Unit:  "percentage",
+		Metrics: []mp.Metrics{
+			{Name: "pool_exhausted_pct", Label: "Time with zero pool capacity", Diff: false},
+		},
+	},
+}
+
+// State file written by the sampler subcommand
+type samplerState struct {
+	UpdatedAt time.Time `json:"updated_at"`
+	Window    float64   `json:"window_seconds"`
+	Samples   int       `json:"samples"`
+	// min/avg/max/p95 as fetchSampleMetrics, and pool_exhausted_pct
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+// A /stats sample taken by the sampler
+type timedSample struct {
+	At     time.Time
+	Totals map[string]float64
+}
+
+// Aggregates of the samples taken within window before now
+func aggregateSamples(samples []timedSample, now time.Time, window time.Duration) samplerState {
+	var totals []map[string]float64
+	exhausted := 0
+	for _, s := range samples {
+		if now.Sub(s.At) > window {
+			continue
+		}
+		totals = append(totals, s.Totals)
+		if s.Totals["pool_exhausted"] == 1 {
+			exhausted++
+		}
+	}
+
+	state := samplerState{
+		UpdatedAt: now,
+		Window:    window.Seconds(),
+		Samples:   len(totals),
+		Metrics:   fetchSampleMetrics(totals),
+	}
+	if len(totals) > 0 {
+		state.Metrics["pool_exhausted_pct"] = 100 * float64(exhausted) / float64(len(totals))
+	}
+	return state
+}
+
+// Lock of path held by the sampler while replacing it, so that two samplers do not interleave
+func lockState(path string) (*os.File, error) {
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Replace path with state atomically, through a temp file renamed over it
+func writeSamplerState(path string, state samplerState) error {
+	lock, err := lockState(path)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := json.NewEncoder(tmp).Encode(state); err != nil {
+		tmp.Close()
+		return err
+	}
+	// Readable by a plugin running as another user, CreateTemp makes it 0600
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Read the state written by the sampler, refusing one older than its window.
+// The file is replaced by a rename, so it is read without the lock.
+func readSamplerState(path string, now time.Time) (*samplerState, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var state samplerState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, err
+	}
+
+	window := time.Duration(state.Window * float64(time.Second))
+	if now.Sub(state.UpdatedAt) > window {
+		return nil, errors.New(path + ": sampler state is stale, updated at " + state.UpdatedAt.Format(time.RFC3339))
+	}
+	return &state, nil
+}
+
+// Metrics of the sampler state file, keyed as in graphdefSampler
+func (p PumaPlugin) fetchSamplerMetrics(now time.Time) (map[string]float64, error) {
+	state, err := readSamplerState(p.SamplerState, now)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]float64)
+	for k, v := range state.Metrics {
+		if k == "pool_exhausted_pct" {
+			ret[k] = v
+			continue
+		}
+		ret["sampled_"+k] = v
+	}
+	return ret, nil
+}
+
+// Poll /stats every interval until ctx is done, writing the aggregates over window to path
+func (p PumaPlugin) runSampler(ctx context.Context, c *client.Client, path string, interval, window time.Duration) error {
+	var samples []timedSample
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		stats, err := c.Stats(ctx)
+		now := time.Now()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			warn(err)
+		} else {
+			samples = append(samples, timedSample{At: now, Totals: p.detectMode(stats).sampleTotals(stats)})
+		}
+
+		// Drop samples out of the window
+		for len(samples) > 0 && now.Sub(samples[0].At) > window {
+			samples = samples[1:]
+		}
+
+		if err := writeSamplerState(path, aggregateSamples(samples, now, window)); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func doSampler(args []string) error {
+	var p PumaPlugin
+
+	fs := flag.NewFlagSet("sampler", flag.ExitOnError)
+	p.connectionFlags(fs)
+	optState := fs.String("state-file", "", "File to write the aggregates to, read by the plugin with -sampler-state")
+	optInterval := fs.Duration("interval", time.Second, "Interval between /stats requests")
+	optWindow := fs.Duration("window", time.Minute, "Aggregate the samples taken within this window")
+	fs.Parse(args)
+
+	if *optState == "" {
+		return errors.New("-state-file is required")
+	}
+
+	c, err := p.newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return p.runSampler(ctx, c, *optState, *optInterval, *optWindow)
+}
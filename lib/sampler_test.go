@@ -0,0 +1,128 @@
+package mppuma
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/rmanzoku/mackerel-plugin-puma/lib/client"
+	"github.com/rmanzoku/mackerel-plugin-puma/lib/pumatest"
+)
+
+func TestAggregateSamples(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC)
+
+	// One worker is exhausted at backlog 2 while the total pool capacity is not zero
+	var samples []timedSample
+	for i, v := range []float64{0, 2, 0, 4, 0} {
+		samples = append(samples, timedSample{
+			At:     now.Add(time.Duration(i-4) * time.Second),
+			Totals: map[string]float64{"backlog": v, "running": 5, "pool_capacity": 4 - v, "pool_exhausted": boolMetric(v > 0)},
+		})
+	}
+	// Out of the window
+	samples = append([]timedSample{{
+		At:     now.Add(-2 * time.Minute),
+		Totals: map[string]float64{"backlog": 100, "running": 5, "pool_capacity": 0, "pool_exhausted": 1},
+	}}, samples...)
+
+	state := aggregateSamples(samples, now, time.Minute)
+
+	if state.Samples != 5 {
+		t.Errorf("samples should be 5, out %d", state.Samples)
+	}
+
+	desired := map[string]float64{
+		"backlog_max":        4,
+		"backlog_avg":        1.2,
+		"pool_capacity_min":  0,
+		"pool_exhausted_pct": 40,
+	}
+	for k, v := range desired {
+		if state.Metrics[k] != v {
+			t.Errorf("%s should be %f, out %f", k, v, state.Metrics[k])
+		}
+	}
+}
+
+func TestSamplerState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sampler.json")
+	now := time.Now()
+
+	state := samplerState{
+		UpdatedAt: now,
+		Window:    60,
+		Samples:   1,
+		Metrics:   map[string]float64{"backlog_max": 3, "pool_exhausted_pct": 50},
+	}
+	if err := writeSamplerState(path, state); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path); err != nil || runtime.GOOS != "windows" && fi.Mode().Perm() != 0644 {
+		t.Errorf("sampler state should be readable by other users, out %v %v", fi.Mode(), err)
+	}
+
+	p := PumaPlugin{SamplerState: path}
+	ret, err := p.fetchSamplerMetrics(now.Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret["sampled_backlog_max"] != 3 {
+		t.Errorf("sampled_backlog_max should be 3, out %f", ret["sampled_backlog_max"])
+	}
+	if ret["pool_exhausted_pct"] != 50 {
+		t.Errorf("pool_exhausted_pct should be 50, out %f", ret["pool_exhausted_pct"])
+	}
+
+	if _, err := p.fetchSamplerMetrics(now.Add(2 * time.Minute)); err == nil {
+		t.Errorf("stale sampler state should be an error")
+	}
+}
+
+func TestRunSampler(t *testing.T) {
+	s := pumatest.NewServer(pumatest.Puma6Cluster)
+	defer s.Close()
+
+	p := pumatestPlugin(s, pumatest.Puma6Cluster)
+	c, err := p.newClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "sampler.json")
+	ctx, cancel := context.WithTimeout(context.Background(), 55*time.Millisecond)
+	defer cancel()
+
+	if err := p.runSampler(ctx, c, path, 10*time.Millisecond, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := readSamplerState(path, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Samples < 2 {
+		t.Errorf("samples should be at least 2, out %d", state.Samples)
+	}
+	if _, ok := state.Metrics["backlog_p95"]; !ok {
+		t.Errorf("backlog_p95 not exists")
+	}
+}
+
+func TestSampleTotalsPoolExhausted(t *testing.T) {
+	stats := Stats{
+		Workers: 2,
+		WorkerStatus: []client.WorkerStatus{
+			{Index: 0, LastStatus: client.LastStatus{Reported: true, PoolCapacity: 0}},
+			{Index: 1, LastStatus: client.LastStatus{Reported: true, PoolCapacity: 5}},
+		},
+	}
+
+	var p PumaPlugin
+	if ret := p.sampleTotals(&stats); ret["pool_exhausted"] != 1 {
+		t.Errorf("a sample with one worker at zero pool capacity should be exhausted, out %v", ret)
+	}
+}
@@ -1,25 +1,42 @@
 package mppuma
 
 import (
-	"encoding/json"
-	"errors"
-	"fmt"
-	"net"
-	"net/http"
-	"strconv"
+	"context"
 	"time"
 
 	mp "github.com/mackerelio/go-mackerel-plugin"
+	"github.com/rmanzoku/mackerel-plugin-puma/lib/client"
 )
 
+var graphdefControl = map[string]mp.Graphs{
+	"control": {
+		Label: "Puma Control Server",
+		Unit:  "float",
+		Metrics: []mp.Metrics{
+			{Name: "up", Label: "Up", Diff: false},
+			{Name: "response_time_ms", Label: "Response time (ms)", Diff: false},
+		},
+	},
+}
+
 var graphdefStats = map[string]mp.Graphs{
 	"workers": {
 		Label: "Puma Workers",
 		Unit:  "integer",
 		Metrics: []mp.Metrics{
-			{Name: "workers", Label: "Active workers", Diff: false},
-			{Name: "spawn_workers", Label: "Spawn workers", Diff: true},
-			{Name: "removed_workers", Label: "Removed workers", Diff: true},
+			{Name: "booted", Label: "Booted workers", Diff: false, Stacked: true},
+			{Name: "missing", Label: "Missing workers", Diff: false, Stacked: true},
+			{Name: "configured", Label: "Configured workers", Diff: false},
+			{Name: "old", Label: "Old phase workers", Diff: false},
+			{Name: "unbooted", Label: "Unbooted workers", Diff: false},
+		},
+	},
+	"threads": {
+		Label: "Puma Threads",
+		Unit:  "integer",
+		Metrics: []mp.Metrics{
+			{Name: "busy", Label: "Busy threads", Diff: false},
+			{Name: "capacity", Label: "Thread capacity", Diff: false},
 		},
 	},
 	"backlog.#": {
@@ -43,6 +60,30 @@ var graphdefStats = map[string]mp.Graphs{
 			{Name: "pool_capacity", Label: "Pool Capacity", Diff: false, Stacked: true},
 		},
 	},
+	"booted.#": {
+		Label: "Puma Worker Booted",
+		Unit:  "integer",
+		Metrics: []mp.Metrics{
+			{Name: "booted", Label: "Booted", Diff: false, Stacked: true},
+		},
+	},
+	"saturation": {
+		Label: "Puma Saturation",
+		Unit:  "integer",
+		Metrics: []mp.Metrics{
+			{Name: "pool_exhausted", Label: "Any worker with zero pool capacity", Diff: false},
+			{Name: "backlog_nonzero", Label: "Any worker with backlog", Diff: false},
+			{Name: "workers_exhausted", Label: "Workers with zero pool capacity", Diff: false},
+			{Name: "workers_with_backlog", Label: "Workers with backlog", Diff: false},
+		},
+	},
+	"requests.#": {
+		Label: "Puma Requests",
+		Unit:  "integer",
+		Metrics: []mp.Metrics{
+			{Name: "requests", Label: "Requests", Diff: true, Stacked: true},
+		},
+	},
 	"phase": {
 		Label: "Puma Phase",
 		Unit:  "integer",
@@ -53,6 +94,14 @@ var graphdefStats = map[string]mp.Graphs{
 }
 
 var graphdefStatsSingle = map[string]mp.Graphs{
+	"threads": {
+		Label: "Puma Threads",
+		Unit:  "integer",
+		Metrics: []mp.Metrics{
+			{Name: "busy", Label: "Busy threads", Diff: false},
+			{Name: "capacity", Label: "Thread capacity", Diff: false},
+		},
+	},
 	"backlog": {
 		Label: "Puma Backlog",
 		Unit:  "integer",
@@ -74,64 +123,44 @@ var graphdefStatsSingle = map[string]mp.Graphs{
 			{Name: "pool_capacity", Label: "Pool Capacity", Diff: false, Stacked: true},
 		},
 	},
+	"saturation": {
+		Label: "Puma Saturation",
+		Unit:  "integer",
+		Metrics: []mp.Metrics{
+			{Name: "pool_exhausted", Label: "Zero pool capacity", Diff: false},
+			{Name: "backlog_nonzero", Label: "Backlog", Diff: false},
+		},
+	},
+	"requests": {
+		Label: "Puma Requests",
+		Unit:  "integer",
+		Metrics: []mp.Metrics{
+			{Name: "requests", Label: "Requests", Diff: true},
+		},
+	},
 }
 
 // Stats is convered from /stats json
-type Stats struct {
-	Workers       int `json:"workers"`
-	Phase         int `json:"phase"`
-	BootedWorkers int `json:"booted_workers"`
-	OldWorkers    int `json:"old_workers"`
-	WorkerStatus  []struct {
-		Pid         int       `json:"pid"`
-		Index       int       `json:"index"`
-		Phase       int       `json:"phase"`
-		Booted      bool      `json:"booted"`
-		LastCheckin time.Time `json:"last_checkin"`
-		LastStatus  struct {
-			Backlog      int `json:"backlog"`
-			Running      int `json:"running"`
-			PoolCapacity int `json:"pool_capacity"`
-		} `json:"last_status"`
-	} `json:"worker_status"`
-	// Single mode
-	Backlog      int `json:"backlog"`
-	Running      int `json:"running"`
-	PoolCapacity int `json:"pool_capacity"`
-}
+type Stats = client.Stats
 
 // GET request to /stats
 func (p PumaPlugin) getStatsAPI() (*Stats, error) {
-
-	var stats Stats
-
-	var client http.Client
-
-	if p.Sock != "" {
-		client = http.Client{Transport: &http.Transport{
-			Dial: func(proto, addr string) (conn net.Conn, err error) {
-				return net.Dial("unix", p.Sock)
-			},
-		}}
-	} else {
-		client = http.Client{}
-	}
-
-	uri := fmt.Sprintf("http://%s:%s/%s?token=%s", p.Host, p.Port, "stats", p.Token)
-	resp, err := client.Get(uri)
+	c, err := p.newClient()
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return c.Stats(context.Background())
+}
 
-	if resp.StatusCode != 200 {
-		return nil, errors.New(resp.Status)
+// Availability of the control server and response time of /stats
+func fetchControlMetrics(up bool, responseTime time.Duration) map[string]float64 {
+	if !up {
+		return map[string]float64{"up": 0}
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
-		return nil, err
+	return map[string]float64{
+		"up":               1,
+		"response_time_ms": float64(responseTime) / float64(time.Millisecond),
 	}
-
-	return &stats, nil
 }
 
 // Fetch /stats
@@ -142,20 +171,121 @@ func (p PumaPlugin) fetchStatsMetrics(stats *Stats) map[string]float64 {
 		ret["backlog"] = float64(stats.Backlog)
 		ret["running"] = float64(stats.Running)
 		ret["pool_capacity"] = float64(stats.PoolCapacity)
+		if stats.RequestsCount != nil {
+			ret["requests"] = float64(*stats.RequestsCount)
+		}
+		ret["pool_exhausted"] = boolMetric(stats.PoolCapacity == 0)
+		ret["backlog_nonzero"] = boolMetric(stats.Backlog > 0)
+
+		// max_threads is reported since Puma 4.0, before that it comes from config/puma.rb
+		maxThreads := p.MaxThreads
+		if stats.MaxThreads > 0 {
+			maxThreads = stats.MaxThreads
+		}
+		if maxThreads > 0 {
+			ret["capacity"] = float64(maxThreads)
+			ret["busy"] = float64(maxThreads - stats.PoolCapacity)
+		}
 		return ret
 	}
 
-	ret["workers"] = float64(stats.Workers)
-	ret["spawn_workers"] = float64(stats.BootedWorkers)
-	ret["removed_workers"] = float64(stats.OldWorkers)
+	// workers of config/puma.rb, when the master was started with another count
+	configured := stats.Workers
+	if p.ConfiguredWorkers > 0 {
+		configured = p.ConfiguredWorkers
+	}
+	ret["configured"] = float64(configured)
+	ret["booted"] = float64(stats.BootedWorkers)
+	ret["old"] = float64(stats.OldWorkers)
+	ret["missing"] = 0
+	if configured > stats.BootedWorkers {
+		ret["missing"] = float64(configured - stats.BootedWorkers)
+	}
 	ret["phase"] = float64(stats.Phase)
 
-	for _, v := range stats.WorkerStatus {
-		ret["backlog.worker"+strconv.Itoa(v.Index)+".backlog"] = float64(v.LastStatus.Backlog)
-		ret["running.worker"+strconv.Itoa(v.Index)+".running"] = float64(v.LastStatus.Running)
-		ret["running.worker"+strconv.Itoa(v.Index)+".pool_capacity"] = float64(v.LastStatus.PoolCapacity)
+	maxThreads := p.MaxThreads
+	ret["unbooted"] = 0
+	ret["workers_exhausted"] = 0
+	ret["workers_with_backlog"] = 0
+	keys := p.workerKeys(stats)
+	for i, v := range stats.WorkerStatus {
+		if !v.Booted {
+			ret["unbooted"]++
+		}
+		if v.LastStatus.Reported && v.LastStatus.PoolCapacity == 0 {
+			ret["workers_exhausted"]++
+		}
+		if v.LastStatus.Reported && v.LastStatus.Backlog > 0 {
+			ret["workers_with_backlog"]++
+		}
+		if v.LastStatus.MaxThreads > 0 {
+			maxThreads = v.LastStatus.MaxThreads
+		}
+
+		// Beyond -max-worker-series
+		if keys[i] == "" {
+			continue
+		}
+		ret["booted."+keys[i]+".booted"] = 0
+		if v.Booted {
+			ret["booted."+keys[i]+".booted"] = 1
+		}
+
+		// Zeros of a worker yet to check in would look like an idle worker
+		if !v.LastStatus.Reported {
+			continue
+		}
+		ret["backlog."+keys[i]+".backlog"] = float64(v.LastStatus.Backlog)
+		ret["running."+keys[i]+".running"] = float64(v.LastStatus.Running)
+		ret["pool_capacity."+keys[i]+".pool_capacity"] = float64(v.LastStatus.PoolCapacity)
+		if v.LastStatus.RequestsCount != nil {
+			ret["requests."+keys[i]+".requests"] = float64(*v.LastStatus.RequestsCount)
+		}
+	}
+
+	if maxThreads > 0 {
+		busy := 0
+		for _, v := range stats.WorkerStatus {
+			if v.LastStatus.Reported {
+				busy += maxThreads - v.LastStatus.PoolCapacity
+			}
+		}
+		// Threads the running master can serve with, against busy of the same workers;
+		// configured and missing follow config/puma.rb to catch a count needing a restart
+		ret["capacity"] = float64(stats.Workers * maxThreads)
+		ret["busy"] = float64(busy)
 	}
 
+	// One series for monitors to fire on any of the workers
+	ret["pool_exhausted"] = boolMetric(ret["workers_exhausted"] > 0)
+	ret["backlog_nonzero"] = boolMetric(ret["workers_with_backlog"] > 0)
+
 	return ret
 
 }
+
+func boolMetric(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Worker pids and start times, not graphed but used by outputs tagging by pid and
+// by OTLP as the start of cumulative sums
+func (p PumaPlugin) fetchMetaMetrics(stats *Stats) map[string]float64 {
+	ret := make(map[string]float64)
+	if !stats.StartedAt.IsZero() {
+		ret[metaPrefix+"started_at"] = float64(stats.StartedAt.Unix())
+	}
+	for i, key := range p.workerKeys(stats) {
+		if key == "" {
+			continue
+		}
+		ret[metaPrefix+"pid."+key] = float64(stats.WorkerStatus[i].Pid)
+		if started := stats.WorkerStatus[i].StartedAt; !started.IsZero() {
+			ret[metaPrefix+"started_at."+key] = float64(started.Unix())
+		}
+	}
+	return ret
+}
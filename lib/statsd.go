@@ -0,0 +1,120 @@
+package mppuma
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	mp "github.com/mackerelio/go-mackerel-plugin"
+)
+
+// Largest UDP payload sent, to avoid fragmentation on a 1500 MTU
+const statsdPacketSize = 1432
+
+// StatsD lines of points, gauges except Diff metrics sent as counters of the change since prev.
+// With tags, wildcard segments are sent as DogStatsD tags instead of in the name.
+func statsdLines(prefix string, pts []point, prev map[string]float64, tags bool) []string {
+	var lines []string
+
+	for _, p := range pts {
+		name := prefix + "." + p.Key
+		if tags {
+			name = prefix + "." + p.Name
+		}
+
+		value, kind := p.Value, "g"
+		if p.Diff {
+			// Counters need a previous run, and a counter reset is skipped
+			last, ok := prev[p.Key]
+			if !ok || p.Value < last {
+				continue
+			}
+			value, kind = p.Value-last, "c"
+		}
+
+		line := name + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|" + kind
+		if tags && len(p.Tags) > 0 {
+			var t []string
+			for k, v := range p.Tags {
+				t = append(t, k+":"+v)
+			}
+			sort.Strings(t)
+			line += "|#" + strings.Join(t, ",")
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Send lines over UDP, several per packet
+func sendStatsd(addr string, lines []string) error {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var packet []byte
+	for _, line := range lines {
+		if len(packet) > 0 && len(packet)+1+len(line) > statsdPacketSize {
+			if _, err := conn.Write(packet); err != nil {
+				return err
+			}
+			packet = packet[:0]
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		_, err = conn.Write(packet)
+	}
+	return err
+}
+
+// Values of Diff metrics at the previous run
+func readCounters(path string) map[string]float64 {
+	counters := make(map[string]float64)
+	if b, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(b, &counters)
+	}
+	return counters
+}
+
+func writeCounters(path string, pts []point) error {
+	counters := make(map[string]float64)
+	for _, p := range pts {
+		if p.Diff {
+			counters[p.Key] = p.Value
+		}
+	}
+	b, err := json.Marshal(counters)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// Push the metrics of plugin to a StatsD server, keeping counter values in tempfile
+func pushStatsd(plugin mp.PluginWithPrefix, addr string, tags bool, tempfile string) error {
+	metrics, err := plugin.FetchMetrics()
+	if err != nil {
+		return err
+	}
+	pts := points(keyGraphs(plugin), metrics)
+
+	if tempfile == "" {
+		tempfile = filepath.Join(os.TempDir(), "mackerel-plugin-"+plugin.MetricKeyPrefix()+"-statsd")
+	}
+
+	lines := statsdLines(plugin.MetricKeyPrefix(), pts, readCounters(tempfile), tags)
+	if err := sendStatsd(addr, lines); err != nil {
+		return err
+	}
+	return writeCounters(tempfile, pts)
+}
@@ -0,0 +1,96 @@
+package mppuma
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rmanzoku/mackerel-plugin-puma/lib/pumatest"
+)
+
+func TestStatsdLines(t *testing.T) {
+	pts := []point{
+		{Key: "workers.booted", Name: "workers.booted", Value: 2},
+		{Key: "myapp.backlog.worker1.backlog", Name: "backlog.backlog", Value: 3,
+			Tags: map[string]string{"instance": "myapp", "worker": "1"}},
+		{Key: "requests.requests_count", Name: "requests.requests_count", Value: 110, Diff: true},
+		{Key: "requests.reset_count", Name: "requests.reset_count", Value: 5, Diff: true},
+		{Key: "requests.new_count", Name: "requests.new_count", Value: 7, Diff: true},
+	}
+	prev := map[string]float64{
+		"requests.requests_count": 100,
+		"requests.reset_count":    50,
+	}
+
+	desired := []string{
+		"puma.workers.booted:2|g",
+		"puma.myapp.backlog.worker1.backlog:3|g",
+		"puma.requests.requests_count:10|c",
+	}
+	ret := statsdLines("puma", pts, prev, false)
+	if strings.Join(ret, "\n") != strings.Join(desired, "\n") {
+		t.Errorf("statsdLines should be %v, out %v", desired, ret)
+	}
+
+	desired = []string{
+		"puma.workers.booted:2|g",
+		"puma.backlog.backlog:3|g|#instance:myapp,worker:1",
+		"puma.requests.requests_count:10|c",
+	}
+	ret = statsdLines("puma", pts, prev, true)
+	if strings.Join(ret, "\n") != strings.Join(desired, "\n") {
+		t.Errorf("statsdLines with tags should be %v, out %v", desired, ret)
+	}
+}
+
+func TestPushStatsd(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	s := pumatest.NewServer(pumatest.Puma6Cluster)
+	defer s.Close()
+	p := pumatestPlugin(s, pumatest.Puma6Cluster)
+	p.WithGC = false
+
+	tempfile := filepath.Join(t.TempDir(), "statsd")
+	if err := pushStatsd(p, conn.LocalAddr().String(), true, tempfile); err != nil {
+		t.Fatal(err)
+	}
+
+	var received []string
+	buf := make([]byte, statsdPacketSize)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		if n > statsdPacketSize {
+			t.Errorf("packet of %d bytes should not exceed %d", n, statsdPacketSize)
+		}
+		received = append(received, strings.Split(string(buf[:n]), "\n")...)
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	}
+
+	for _, want := range []string{"puma.control.up:1|g", "puma.workers.booted:", "puma.backlog.backlog:"} {
+		found := false
+		for _, line := range received {
+			if strings.HasPrefix(line, want) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s should be sent, out %v", want, received)
+		}
+	}
+	for _, line := range received {
+		if strings.HasPrefix(line, "puma.backlog.backlog:") && !strings.Contains(line, "|#worker:") {
+			t.Errorf("%s should be tagged with worker", line)
+		}
+	}
+}
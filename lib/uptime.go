@@ -0,0 +1,68 @@
+package mppuma
+
+import (
+	"time"
+
+	mp "github.com/mackerelio/go-mackerel-plugin"
+)
+
+var graphdefUptime = map[string]mp.Graphs{
+	"uptime": {
+		Label: "Puma Uptime",
+		Unit:  "seconds",
+		Metrics: []mp.Metrics{
+			{Name: "uptime_seconds", Label: "Master uptime", Diff: false},
+		},
+	},
+}
+
+var graphdefWorkerAge = map[string]mp.Graphs{
+	"worker_age": {
+		Label: "Puma Worker Age",
+		Unit:  "seconds",
+		Metrics: []mp.Metrics{
+			{Name: "age_min", Label: "Youngest worker", Diff: false},
+			{Name: "age_max", Label: "Oldest worker", Diff: false},
+		},
+	},
+	"age.#": {
+		Label: "Puma Worker Age per Worker",
+		Unit:  "seconds",
+		Metrics: []mp.Metrics{
+			{Name: "age_seconds", Label: "Age", Diff: false},
+		},
+	},
+}
+
+// Uptime of the master and age of each worker at now, from started_at of Puma 5.0+
+func (p PumaPlugin) fetchUptimeMetrics(stats *Stats, now time.Time) map[string]float64 {
+	ret := make(map[string]float64)
+
+	if !stats.StartedAt.IsZero() {
+		ret["uptime_seconds"] = now.Sub(stats.StartedAt).Seconds()
+	}
+	if p.Single == true {
+		return ret
+	}
+
+	first := true
+	keys := p.workerKeys(stats)
+	for i, v := range stats.WorkerStatus {
+		if v.StartedAt.IsZero() {
+			continue
+		}
+		age := now.Sub(v.StartedAt).Seconds()
+		if keys[i] != "" {
+			ret["age."+keys[i]+".age_seconds"] = age
+		}
+
+		if first || age < ret["age_min"] {
+			ret["age_min"] = age
+		}
+		if first || age > ret["age_max"] {
+			ret["age_max"] = age
+		}
+		first = false
+	}
+	return ret
+}
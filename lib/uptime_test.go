@@ -0,0 +1,59 @@
+package mppuma
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestFetchUptimeMetrics(t *testing.T) {
+	statJSON := `{
+	  "started_at": "2023-11-08T02:00:00Z",
+	  "workers": 3,
+	  "booted_workers": 2,
+	  "worker_status": [
+	    { "started_at": "2023-11-08T02:00:10Z", "pid": 601, "index": 0, "booted": true },
+	    { "started_at": "2023-11-08T02:50:00Z", "pid": 602, "index": 1, "booted": true },
+	    { "pid": 603, "index": 2, "booted": false }
+	  ]
+	}`
+	now := time.Date(2023, 11, 8, 3, 0, 0, 0, time.UTC)
+
+	desired := map[string]float64{
+		"uptime_seconds":          3600,
+		"age.worker0.age_seconds": 3590,
+		"age.worker1.age_seconds": 600,
+		"age_min":                 600,
+		"age_max":                 3590,
+	}
+
+	var p PumaPlugin
+	var stats Stats
+	json.Unmarshal([]byte(statJSON), &stats)
+
+	ret := p.fetchUptimeMetrics(&stats, now)
+
+	if len(ret) != len(desired) {
+		t.Errorf("fetchUptimeMetrics: len(ret) = %d should be len(desired) = %d", len(ret), len(desired))
+	}
+	for k, v := range desired {
+		if ret[k] != v {
+			t.Errorf("%s should be %f, out %f", k, v, ret[k])
+		}
+	}
+
+	// Before Puma 5.0
+	if ret := p.fetchUptimeMetrics(&Stats{Workers: 2}, now); len(ret) != 0 {
+		t.Errorf("fetchUptimeMetrics without started_at should be empty, out %v", ret)
+	}
+}
+
+func TestFetchUptimeMetricsSingle(t *testing.T) {
+	p := PumaPlugin{Single: true}
+	stats := Stats{StartedAt: time.Date(2023, 11, 8, 2, 0, 0, 0, time.UTC)}
+
+	ret := p.fetchUptimeMetrics(&stats, stats.StartedAt.Add(90*time.Second))
+	if len(ret) != 1 || ret["uptime_seconds"] != 90 {
+		t.Errorf("uptime_seconds should be 90 only, out %v", ret)
+	}
+}
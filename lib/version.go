@@ -0,0 +1,118 @@
+package mppuma
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"strconv"
+	"strings"
+
+	mp "github.com/mackerelio/go-mackerel-plugin"
+	"github.com/rmanzoku/mackerel-plugin-puma/lib/client"
+)
+
+var graphdefVersion = map[string]mp.Graphs{
+	"version": {
+		Label: "Puma Version",
+		Unit:  "integer",
+		Metrics: []mp.Metrics{
+			{Name: "puma", Label: "Puma (major*10000+minor*100+patch)", Diff: false},
+			{Name: "ruby", Label: "Ruby (major*10000+minor*100+patch)", Diff: false},
+		},
+	},
+}
+
+// Versions is converted from versions of /stats json
+type Versions = client.Versions
+
+// Number of a version such as 6.4.2 as 60402, ignoring pre-release suffixes
+func versionNumber(version string) (float64, bool) {
+	parts := strings.SplitN(version, ".", 4)
+	if len(parts) < 2 {
+		return 0, false
+	}
+
+	n := 0
+	for i := 0; i < 3; i++ {
+		v := 0
+		if i < len(parts) {
+			var err error
+			if v, err = strconv.Atoi(parts[i]); err != nil || v > 99 {
+				return 0, false
+			}
+		}
+		n = n*100 + v
+	}
+	return float64(n), true
+}
+
+// Puma and Ruby versions reported by Puma 6.0+
+func fetchVersionMetrics(stats *Stats) map[string]float64 {
+	ret := make(map[string]float64)
+	if stats.Versions == nil {
+		return ret
+	}
+
+	if n, ok := versionNumber(stats.Versions.Puma); ok {
+		ret["puma"] = n
+	}
+	if n, ok := versionNumber(stats.Versions.Ruby.Version); ok {
+		ret["ruby"] = n
+	}
+	return ret
+}
+
+// Plugins which can tell the versions of /stats along with the metrics
+type versionsFetcher interface {
+	fetchMetricsVersions() (map[string]float64, map[string]*Versions, error)
+}
+
+// Resource attributes of the versions reported by Puma 6.0+
+func versionAttributes(v *Versions) map[string]string {
+	ret := make(map[string]string)
+	if v == nil {
+		return ret
+	}
+	if v.Puma != "" {
+		ret["puma.version"] = v.Puma
+	}
+	if v.Ruby.Engine != "" {
+		ret["process.runtime.name"] = v.Ruby.Engine
+	}
+	if v.Ruby.Version != "" {
+		ret["process.runtime.version"] = v.Ruby.Version
+
+		// RUBY_PATCHLEVEL is -1 on development builds and other engines
+		description := strings.TrimSpace(v.Ruby.Engine + " " + v.Ruby.Version)
+		if v.Ruby.Patchlevel >= 0 {
+			description += "p" + strconv.Itoa(v.Ruby.Patchlevel)
+		}
+		ret["process.runtime.description"] = description
+	}
+	return ret
+}
+
+// Print the versions of /stats as mackerel-agent metadata plugin JSON
+func doMetadata(args []string) error {
+	var p PumaPlugin
+
+	fs := flag.NewFlagSet("metadata", flag.ExitOnError)
+	p.connectionFlags(fs)
+	fs.Parse(args)
+
+	c, err := p.newClient()
+	if err != nil {
+		return err
+	}
+	stats, err := c.Stats(context.Background())
+	if err != nil {
+		return err
+	}
+	if stats.Versions == nil {
+		return errors.New("/stats has no versions, reported since Puma 6.0")
+	}
+
+	return json.NewEncoder(os.Stdout).Encode(stats.Versions)
+}
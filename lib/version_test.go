@@ -0,0 +1,60 @@
+package mppuma
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestVersionNumber(t *testing.T) {
+	cases := []struct {
+		version string
+		number  float64
+		ok      bool
+	}{
+		{"6.4.2", 60402, true},
+		{"3.2.2", 30202, true},
+		{"6.0.0.rc1", 60000, true},
+		{"5.6", 50600, true},
+		{"9.3.9.0", 90309, true},
+		{"6", 0, false},
+		{"", 0, false},
+		{"6.x.0", 0, false},
+	}
+
+	for _, c := range cases {
+		n, ok := versionNumber(c.version)
+		if n != c.number || ok != c.ok {
+			t.Errorf("versionNumber(%q) should be %f %v, out %f %v", c.version, c.number, c.ok, n, ok)
+		}
+	}
+}
+
+func TestFetchVersionMetrics(t *testing.T) {
+	statJSON := `{
+	  "backlog": 0,
+	  "versions": {
+	    "puma": "6.4.2",
+	    "ruby": { "engine": "ruby", "version": "3.3.1", "patchlevel": 55 }
+	  }
+	}`
+
+	var stats Stats
+	json.Unmarshal([]byte(statJSON), &stats)
+
+	if stats.Versions.Ruby.Engine != "ruby" || stats.Versions.Ruby.Patchlevel != 55 {
+		t.Errorf("versions.ruby should be decoded, out %+v", stats.Versions.Ruby)
+	}
+
+	ret := fetchVersionMetrics(&stats)
+	if ret["puma"] != 60402 {
+		t.Errorf("puma should be 60402, out %f", ret["puma"])
+	}
+	if ret["ruby"] != 30301 {
+		t.Errorf("ruby should be 30301, out %f", ret["ruby"])
+	}
+
+	// Before Puma 6.0
+	if ret := fetchVersionMetrics(&Stats{}); len(ret) != 0 {
+		t.Errorf("fetchVersionMetrics without versions should be empty, out %v", ret)
+	}
+}
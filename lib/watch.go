@@ -0,0 +1,136 @@
+package mppuma
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+)
+
+// Progress of a phased restart towards Phase
+type restartProgress struct {
+	Phase     int
+	Workers   int
+	OnPhase   int
+	Booted    int
+	CheckedIn int
+}
+
+// Count workers on phase, and those booted and checked in after since, a time of the server clock
+func newRestartProgress(stats *Stats, phase int, since time.Time) restartProgress {
+	r := restartProgress{Phase: phase, Workers: stats.Workers}
+
+	for _, v := range stats.WorkerStatus {
+		if v.Phase != phase {
+			continue
+		}
+		r.OnPhase++
+		if v.Booted {
+			r.Booted++
+		}
+		if v.LastCheckin.After(since) {
+			r.CheckedIn++
+		}
+	}
+	return r
+}
+
+func (r restartProgress) done() bool {
+	return r.Workers > 0 && r.OnPhase == r.Workers && r.Booted == r.Workers && r.CheckedIn == r.Workers
+}
+
+func (r restartProgress) String() string {
+	return fmt.Sprintf("phase %d: %d/%d workers on new phase, %d/%d booted, %d/%d checked in",
+		r.Phase, r.OnPhase, r.Workers, r.Booted, r.Workers, r.CheckedIn, r.Workers)
+}
+
+// Newest last_checkin of the workers, to compare later checkins with the server clock rather than ours
+func latestCheckin(stats *Stats) time.Time {
+	var ret time.Time
+	for _, v := range stats.WorkerStatus {
+		if v.LastCheckin.After(ret) {
+			ret = v.LastCheckin
+		}
+	}
+	return ret
+}
+
+// The phase a restart observed in stats is heading to
+func targetPhase(stats *Stats) int {
+	for _, v := range stats.WorkerStatus {
+		if v.Phase < stats.Phase {
+			// phased restart already in progress
+			return stats.Phase
+		}
+	}
+	return stats.Phase + 1
+}
+
+// Poll /stats and print progress until all workers reach phase
+func (p PumaPlugin) watchRestart(phase int, timeout, interval time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	// Baseline of checkins taken at the first poll
+	var since *time.Time
+	var last string
+	for {
+		stats, err := p.getStatsAPI()
+		if err != nil {
+			if time.Now().After(deadline) {
+				return err
+			}
+			time.Sleep(interval)
+			continue
+		}
+		if stats.Workers == 0 {
+			return errors.New("watch-restart is not available in single mode")
+		}
+		if phase < 0 {
+			phase = targetPhase(stats)
+		}
+		if since == nil {
+			t := latestCheckin(stats)
+			since = &t
+		}
+
+		progress := newRestartProgress(stats, phase, *since)
+		if s := progress.String(); s != last {
+			fmt.Println(s)
+			last = s
+		}
+		if progress.done() {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("restart did not finish within %s", timeout)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// Options of the watch-restart subcommand
+type watchRestartOptions struct {
+	plugin   PumaPlugin
+	phase    int
+	timeout  time.Duration
+	interval time.Duration
+}
+
+// Flags of the watch-restart subcommand, the connection flags and its own
+func (o *watchRestartOptions) flags() *flag.FlagSet {
+	fs := flag.NewFlagSet("watch-restart", flag.ExitOnError)
+	o.plugin.connectionFlags(fs)
+	fs.IntVar(&o.phase, "phase", -1, "Phase the workers should reach (default: the next phase, or the current one if a restart is in progress)")
+	fs.DurationVar(&o.timeout, "wait-timeout", 60*time.Second, "Exit non-zero if the restart has not finished within this time")
+	fs.DurationVar(&o.interval, "interval", time.Second, "Interval between /stats requests")
+	return fs
+}
+
+// Run the watch-restart subcommand
+func doWatchRestart(args []string) error {
+	var o watchRestartOptions
+	o.flags().Parse(args)
+
+	return o.plugin.watchRestart(o.phase, o.timeout, o.interval)
+}
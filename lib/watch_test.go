@@ -0,0 +1,74 @@
+package mppuma
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestRestartProgress(t *testing.T) {
+
+	statJSON := `{
+	  "workers": 3,
+	  "phase": 1,
+	  "booted_workers": 2,
+	  "old_workers": 1,
+	  "worker_status": [
+	    {"pid": 4, "index": 0, "phase": 1, "booted": true, "last_checkin": "2018-04-17T01:24:16Z"},
+	    {"pid": 5, "index": 1, "phase": 1, "booted": false, "last_checkin": "2018-04-17T01:24:00Z"},
+	    {"pid": 3, "index": 2, "phase": 0, "booted": true, "last_checkin": "2018-04-17T01:24:16Z"}
+	  ]
+	}`
+
+	var stats Stats
+	json.Unmarshal([]byte(statJSON), &stats)
+
+	if checkin := latestCheckin(&stats); checkin.Format(time.RFC3339) != "2018-04-17T01:24:16Z" {
+		t.Errorf("latestCheckin: should be 2018-04-17T01:24:16Z, out %s", checkin.Format(time.RFC3339))
+	}
+
+	if phase := targetPhase(&stats); phase != 1 {
+		t.Errorf("targetPhase: should be 1, out %d", phase)
+	}
+
+	since, _ := time.Parse(time.RFC3339, "2018-04-17T01:24:10Z")
+	ret := newRestartProgress(&stats, 1, since)
+
+	desired := restartProgress{Phase: 1, Workers: 3, OnPhase: 2, Booted: 1, CheckedIn: 1}
+	if ret != desired {
+		t.Errorf("newRestartProgress: should be %+v, out %+v", desired, ret)
+	}
+	if ret.done() {
+		t.Errorf("done: should be false")
+	}
+
+	for i := range stats.WorkerStatus {
+		stats.WorkerStatus[i].Phase = 1
+		stats.WorkerStatus[i].Booted = true
+		stats.WorkerStatus[i].LastCheckin = since.Add(time.Second)
+	}
+	if ret := newRestartProgress(&stats, 1, since); !ret.done() {
+		t.Errorf("done: should be true, out %s", ret)
+	}
+	if phase := targetPhase(&stats); phase != 2 {
+		t.Errorf("targetPhase: should be 2, out %d", phase)
+	}
+}
+
+func TestWatchRestartFlags(t *testing.T) {
+	var o watchRestartOptions
+	fs := o.flags()
+
+	if err := fs.Parse([]string{"-timeout", "3s", "-wait-timeout", "120s", "-phase", "2"}); err != nil {
+		t.Fatalf("Parse: %s", err)
+	}
+	if o.plugin.Timeout != 3*time.Second {
+		t.Errorf("-timeout: should be 3s, out %s", o.plugin.Timeout)
+	}
+	if o.timeout != 120*time.Second {
+		t.Errorf("-wait-timeout: should be 120s, out %s", o.timeout)
+	}
+	if o.phase != 2 {
+		t.Errorf("-phase: should be 2, out %d", o.phase)
+	}
+}
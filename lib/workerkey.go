@@ -0,0 +1,56 @@
+package mppuma
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+
+	"github.com/rmanzoku/mackerel-plugin-puma/lib/client"
+)
+
+// Check -worker-key and -max-worker-series
+func (p PumaPlugin) validateWorkerKey() error {
+	switch p.WorkerKey {
+	case "", "index", "pid", "index-phase":
+	default:
+		return errors.New("-worker-key should be index, pid or index-phase, got " + p.WorkerKey)
+	}
+	if p.MaxWorkerSeries < 0 {
+		return errors.New("-max-worker-series should not be negative")
+	}
+	return nil
+}
+
+// Key of the per-worker series of v, such as worker0
+func (p PumaPlugin) workerKey(v client.WorkerStatus) string {
+	switch p.WorkerKey {
+	case "pid":
+		// A re-forked worker starts a new series
+		return "pid" + strconv.Itoa(v.Pid)
+	case "index-phase":
+		// Series of an index are retired at each phased restart
+		return "worker" + strconv.Itoa(v.Index) + "_phase" + strconv.Itoa(v.Phase)
+	}
+	return "worker" + strconv.Itoa(v.Index)
+}
+
+// Keys of the workers of stats in order, empty for those beyond MaxWorkerSeries by index
+func (p PumaPlugin) workerKeys(stats *Stats) []string {
+	keys := make([]string, len(stats.WorkerStatus))
+
+	order := make([]int, len(stats.WorkerStatus))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return stats.WorkerStatus[order[a]].Index < stats.WorkerStatus[order[b]].Index
+	})
+
+	for n, i := range order {
+		if p.MaxWorkerSeries > 0 && n >= p.MaxWorkerSeries {
+			break
+		}
+		keys[i] = p.workerKey(stats.WorkerStatus[i])
+	}
+	return keys
+}
@@ -0,0 +1,101 @@
+package mppuma
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const workerKeyStatsJSON = `{
+  "workers": 3,
+  "phase": 2,
+  "booted_workers": 3,
+  "worker_status": [
+    { "pid": 703, "index": 2, "phase": 2, "booted": true, "last_status": {"backlog": 3, "running": 5, "pool_capacity": 0} },
+    { "pid": 701, "index": 0, "phase": 2, "booted": true, "last_status": {"backlog": 1, "running": 5, "pool_capacity": 4} },
+    { "pid": 702, "index": 1, "phase": 1, "booted": true, "last_status": {"backlog": 2, "running": 5, "pool_capacity": 2} }
+  ]
+}`
+
+func TestWorkerKeys(t *testing.T) {
+	var stats Stats
+	json.Unmarshal([]byte(workerKeyStatsJSON), &stats)
+
+	cases := []struct {
+		key     string
+		max     int
+		desired []string
+	}{
+		{"index", 0, []string{"worker2", "worker0", "worker1"}},
+		{"", 0, []string{"worker2", "worker0", "worker1"}},
+		{"pid", 0, []string{"pid703", "pid701", "pid702"}},
+		{"index-phase", 0, []string{"worker2_phase2", "worker0_phase2", "worker1_phase1"}},
+		{"index", 2, []string{"", "worker0", "worker1"}},
+		{"pid", 1, []string{"", "pid701", ""}},
+	}
+
+	for _, c := range cases {
+		p := PumaPlugin{WorkerKey: c.key, MaxWorkerSeries: c.max}
+		keys := p.workerKeys(&stats)
+		for i := range c.desired {
+			if keys[i] != c.desired[i] {
+				t.Errorf("-worker-key=%s -max-worker-series=%d: keys should be %v, out %v", c.key, c.max, c.desired, keys)
+				break
+			}
+		}
+	}
+}
+
+func TestFetchStatsMetricsWorkerKey(t *testing.T) {
+	var stats Stats
+	json.Unmarshal([]byte(workerKeyStatsJSON), &stats)
+
+	p := PumaPlugin{WorkerKey: "pid", MaxWorkerSeries: 2}
+	ret := p.fetchStatsMetrics(&stats)
+
+	desired := map[string]float64{
+		"backlog.pid701.backlog":             1,
+		"backlog.pid702.backlog":             2,
+		"pool_capacity.pid702.pool_capacity": 2,
+		"booted.pid701.booted":               1,
+		"unbooted":                           0,
+	}
+	for k, v := range desired {
+		if _, ok := ret[k]; !ok {
+			t.Errorf("%s not exists", k)
+		}
+		if ret[k] != v {
+			t.Errorf("%s should be %f, out %f", k, v, ret[k])
+		}
+	}
+	for _, k := range []string{"backlog.pid703.backlog", "booted.pid703.booted"} {
+		if _, ok := ret[k]; ok {
+			t.Errorf("%s should not exist beyond -max-worker-series", k)
+		}
+	}
+
+	// Pids are kept for the posted series only
+	if meta := p.fetchMetaMetrics(&stats); meta["meta.pid.pid701"] != 701 || len(meta) != 2 {
+		t.Errorf("meta pids should be keyed as the series, out %v", meta)
+	}
+}
+
+func TestValidateWorkerKey(t *testing.T) {
+	cases := []struct {
+		key   string
+		max   int
+		valid bool
+	}{
+		{"index", 0, true},
+		{"pid", 32, true},
+		{"index-phase", 0, true},
+		{"name", 0, false},
+		{"index", -1, false},
+	}
+
+	for _, c := range cases {
+		p := PumaPlugin{WorkerKey: c.key, MaxWorkerSeries: c.max}
+		if err := p.validateWorkerKey(); (err == nil) != c.valid {
+			t.Errorf("-worker-key=%s -max-worker-series=%d: valid should be %v, out %v", c.key, c.max, c.valid, err)
+		}
+	}
+}